@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	contextx "github.com/ibm-verify/verify-sdk-go/pkg/core/context"
 	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
 )
 
@@ -35,7 +36,17 @@ func DefaultRequestEditors(ctx context.Context, headers *Headers) []RequestEdito
 	return []RequestEditorFn{
 		func(ctx context.Context, req *http.Request) error {
 			if len(headers.Token) > 0 {
-				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", headers.Token))
+				if vc := contextx.GetVerifyContext(ctx); vc != nil && vc.DPoP != nil {
+					proof, err := vc.DPoP.Proof(req.Method, req.URL.String(), headers.Token)
+					if err != nil {
+						return err
+					}
+
+					req.Header.Set("Authorization", fmt.Sprintf("DPoP %s", headers.Token))
+					req.Header.Set("DPoP", proof)
+				} else {
+					req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", headers.Token))
+				}
 			}
 			if len(headers.Accept) > 0 {
 				req.Header.Set("Accept", headers.Accept)
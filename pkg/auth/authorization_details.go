@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+// AuthorizationDetail describes fine-grained authorization data, such as a payment to be
+// consented to, requested using the authorization_details parameter, as described in RFC 9396.
+type AuthorizationDetail struct {
+	// Type identifies the kind of authorization detail, such as payment_initiation. It
+	// determines which other fields are allowed.
+	Type string `json:"type"`
+
+	// Locations contains the locations of the resource servers where access is requested.
+	Locations []string `json:"locations,omitempty"`
+
+	// Actions contains the kinds of actions to be taken on the resource.
+	Actions []string `json:"actions,omitempty"`
+
+	// DataTypes contains the kinds of data being requested from the resource.
+	DataTypes []string `json:"datatypes,omitempty"`
+
+	// Identifier identifies a specific resource available at the API.
+	Identifier string `json:"identifier,omitempty"`
+
+	// Privileges contains the types or levels of privilege being requested.
+	Privileges []string `json:"privileges,omitempty"`
+
+	// Extra contains the fields that are specific to the Type, such as the amount of a payment.
+	Extra map[string]any `json:"-"`
+}
+
+// authorizationDetailFields contains the JSON property names of the common fields of AuthorizationDetail.
+var authorizationDetailFields = jsonFieldNames(reflect.TypeOf(AuthorizationDetail{}))
+
+func (d AuthorizationDetail) MarshalJSON() ([]byte, error) {
+	type authorizationDetail AuthorizationDetail
+	payload, err := json.Marshal(authorizationDetail(d))
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeExtraFields(payload, d.Extra)
+}
+
+func (d *AuthorizationDetail) UnmarshalJSON(data []byte) error {
+	type authorizationDetail AuthorizationDetail
+	if err := json.Unmarshal(data, (*authorizationDetail)(d)); err != nil {
+		return err
+	}
+
+	extra, err := extraFields(data, authorizationDetailFields)
+	if err != nil {
+		return err
+	}
+
+	d.Extra = extra
+	return nil
+}
+
+// SetAuthorizationDetails encodes the authorization details into the authorization_details
+// parameter. The parameters can be passed to the browser, PAR, device, CIBA and token requests
+// of the Client. When a request object is used, the details are included as a JSON array.
+func SetAuthorizationDetails(parameters url.Values, details []AuthorizationDetail) error {
+	for _, d := range details {
+		if d.Type == "" {
+			return errorsx.G11NError("the authorization detail 'type' is required.")
+		}
+	}
+
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return errorsx.G11NError("unable to encode the authorization details; err=%v", err)
+	}
+
+	parameters.Set("authorization_details", string(payload))
+	return nil
+}
+
+// parseAuthorizationDetails decodes the authorization_details value returned by the
+// authorization server.
+func parseAuthorizationDetails(v any) ([]AuthorizationDetail, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var details []AuthorizationDetail
+	if err := json.Unmarshal(payload, &details); err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+const (
+	// BackchannelTokenDeliveryModePoll indicates that the client polls the token endpoint.
+	BackchannelTokenDeliveryModePoll = "poll"
+
+	// BackchannelTokenDeliveryModePing indicates that the authorization server notifies the
+	// client notification endpoint and the client then requests the token.
+	BackchannelTokenDeliveryModePing = "ping"
+
+	// BackchannelTokenDeliveryModePush indicates that the authorization server delivers the
+	// tokens to the client notification endpoint.
+	BackchannelTokenDeliveryModePush = "push"
+
+	// DefaultBackchannelPollInterval is the polling interval used when the authorization
+	// server does not return one.
+	DefaultBackchannelPollInterval = 5 * time.Second
+
+	cibaGrantType = "urn:openid:params:grant-type:ciba"
+)
+
+// BackchannelAuthRequest contains the parameters of a Client-Initiated Backchannel
+// Authentication (CIBA) request. Exactly one of LoginHint, LoginHintToken and IDTokenHint
+// is expected to be set to identify the user.
+type BackchannelAuthRequest struct {
+	// LoginHint identifies the user to authenticate, such as the username or email.
+	LoginHint string
+
+	// LoginHintToken is a token containing information that identifies the user.
+	LoginHintToken string
+
+	// IDTokenHint is an ID token previously issued to the client that identifies the user.
+	IDTokenHint string
+
+	// BindingMessage optionally contains a short message displayed on both the consumption
+	// device, such as the agent's screen, and the authentication device of the user.
+	BindingMessage string
+
+	// UserCode optionally contains a secret code known only to the user, used to prevent
+	// unsolicited authentication requests.
+	UserCode string
+
+	// RequestedExpiry optionally specifies the requested lifetime of the auth_req_id.
+	RequestedExpiry time.Duration
+
+	// ClientNotificationToken is the bearer token the authorization server uses to call the
+	// client notification endpoint. It is required for the ping and push delivery modes.
+	ClientNotificationToken string
+}
+
+// BackchannelAuthResponse is the response of the backchannel authentication endpoint.
+type BackchannelAuthResponse struct {
+	// AuthReqID identifies the authentication request when requesting the token.
+	AuthReqID string `json:"auth_req_id"`
+
+	// ExpiresIn is the lifetime, in seconds, of the AuthReqID.
+	ExpiresIn int64 `json:"expires_in"`
+
+	// Interval is the minimum number of seconds to wait between token requests.
+	Interval int64 `json:"interval,omitempty"`
+
+	// Expiry is the time after which the AuthReqID can no longer be used. It is computed
+	// from ExpiresIn and is not part of the response.
+	Expiry time.Time `json:"expiry"`
+}
+
+// BackchannelNotification is the request sent by the authorization server to the client
+// notification endpoint in the ping and push delivery modes.
+type BackchannelNotification struct {
+	// AuthReqID identifies the authentication request that completed.
+	AuthReqID string
+
+	// TokenResponse contains the tokens delivered in the push mode. The ID token is expected
+	// to be validated, including the urn:openid:params:jwt:claim:auth_req_id claim, before use.
+	TokenResponse *TokenResponse
+
+	// Error contains the error delivered in the push mode when the request failed.
+	Error *OAuthError
+}
+
+// AuthorizeWithBackchannelFlow starts a Client-Initiated Backchannel Authentication (CIBA) flow,
+// which authenticates the user on their own device without a browser redirect. The returned
+// AuthReqID is redeemed using TokenWithBackchannelFlow in the poll mode, or once the client
+// notification endpoint is called in the ping and push modes.
+func (c *Client) AuthorizeWithBackchannelFlow(ctx context.Context, request *BackchannelAuthRequest, parameters url.Values) (*BackchannelAuthResponse, error) {
+	if request == nil || (request.LoginHint == "" && request.LoginHintToken == "" && request.IDTokenHint == "") {
+		return nil, errorsx.G11NError("one of 'loginHint', 'loginHintToken' or 'idTokenHint' is required.")
+	}
+
+	params := url.Values{}
+	if len(c.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	for k := range parameters {
+		params.Set(k, parameters.Get(k))
+	}
+
+	setIfNotEmpty := func(k string, v string) {
+		if v != "" {
+			params.Set(k, v)
+		}
+	}
+
+	setIfNotEmpty("login_hint", request.LoginHint)
+	setIfNotEmpty("login_hint_token", request.LoginHintToken)
+	setIfNotEmpty("id_token_hint", request.IDTokenHint)
+	setIfNotEmpty("binding_message", request.BindingMessage)
+	setIfNotEmpty("user_code", request.UserCode)
+	setIfNotEmpty("client_notification_token", request.ClientNotificationToken)
+	if request.RequestedExpiry > 0 {
+		params.Set("requested_expiry", strconv.FormatInt(int64(request.RequestedExpiry/time.Second), 10))
+	}
+
+	res, body, err := c.postForm(ctx, backchannelAuthenticationEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newResponseError(res, body)
+	}
+
+	authResponse := &BackchannelAuthResponse{}
+	if err := json.Unmarshal(body, authResponse); err != nil {
+		return nil, errorsx.G11NError("unable to parse the backchannel authentication response; err=%v", err)
+	}
+
+	if authResponse.AuthReqID == "" {
+		return nil, errorsx.G11NError("the backchannel authentication response does not contain an 'auth_req_id'")
+	}
+
+	authResponse.Expiry = time.Now().Add(time.Duration(authResponse.ExpiresIn) * time.Second)
+	return authResponse, nil
+}
+
+// TokenWithBackchannelFlow polls the token endpoint until the user completes the backchannel
+// authentication flow, waiting the interval returned by the authorization server between
+// requests and backing off when asked to slow down. It stops when the AuthReqID expires, the
+// user denies the request or the context is cancelled.
+func (c *Client) TokenWithBackchannelFlow(ctx context.Context, authResponse *BackchannelAuthResponse) (*TokenResponse, error) {
+	if authResponse == nil || authResponse.AuthReqID == "" {
+		return nil, errorsx.G11NError("'authResponse' is required.")
+	}
+
+	interval := time.Duration(authResponse.Interval) * time.Second
+	if interval == 0 {
+		interval = DefaultBackchannelPollInterval
+	}
+
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		t, err := c.TokenWithAuthReqID(ctx, authResponse.AuthReqID)
+		switch {
+		case err == nil:
+			return t, nil
+		case errors.Is(err, ErrSlowDown):
+			interval += 5 * time.Second
+		case !errors.Is(err, ErrAuthorizationPending):
+			return nil, err
+		}
+
+		if !authResponse.Expiry.IsZero() && time.Now().After(authResponse.Expiry) {
+			return nil, ErrExpiredToken
+		}
+	}
+}
+
+// TokenWithAuthReqID requests the token for the backchannel authentication request once. It is
+// used in the ping mode after the client notification endpoint is called. While the user has not
+// completed the flow, the error matches ErrAuthorizationPending using errors.Is.
+func (c *Client) TokenWithAuthReqID(ctx context.Context, authReqID string) (*TokenResponse, error) {
+	if authReqID == "" {
+		return nil, errorsx.G11NError("'authReqID' is required.")
+	}
+
+	return c.tokenRequest(ctx, url.Values{
+		"grant_type":  {cibaGrantType},
+		"auth_req_id": {authReqID},
+	})
+}
+
+// ParseBackchannelNotification validates and parses the request sent by the authorization server
+// to the client notification endpoint. The bearer token of the request must match the
+// client_notification_token sent in the backchannel authentication request.
+func ParseBackchannelNotification(r *http.Request, clientNotificationToken string) (*BackchannelNotification, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || clientNotificationToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(clientNotificationToken)) != 1 {
+		return nil, errorsx.G11NError("the client notification token is not valid")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, errorsx.G11NError("unable to read the notification; err=%v", err)
+	}
+
+	payload := struct {
+		TokenResponse
+		OAuthError
+		AuthReqID string `json:"auth_req_id"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errorsx.G11NError("unable to parse the notification; err=%v", err)
+	}
+
+	if payload.AuthReqID == "" {
+		return nil, errorsx.G11NError("the notification does not contain an 'auth_req_id'")
+	}
+
+	notification := &BackchannelNotification{
+		AuthReqID: payload.AuthReqID,
+	}
+
+	if payload.Code != "" {
+		notification.Error = &payload.OAuthError
+	} else if payload.AccessToken != "" {
+		notification.TokenResponse = &payload.TokenResponse
+		if payload.ExpiresIn > 0 {
+			notification.TokenResponse.Expiry = time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second)
+		}
+	}
+
+	return notification, nil
+}
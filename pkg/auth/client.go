@@ -2,9 +2,10 @@ package auth
 
 import (
 	"context"
-	"fmt"
 	"net/url"
+	"strings"
 
+	"github.com/go-jose/go-jose/v4"
 	"github.com/google/uuid"
 	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
 	"github.com/ibm-verify/verify-sdk-go/x/randx"
@@ -30,6 +31,35 @@ type Client struct {
 
 	// Scopes represents optional requestable permissions.
 	Scopes []string
+
+	// Discovery optionally resolves the endpoint URLs from the discovery document of
+	// the tenant. This is needed when the tenant uses a custom domain or non-standard
+	// paths. If not set, the default paths on the Tenant are used.
+	Discovery *Discovery
+
+	// KeySet optionally caches the tenant keys used to verify signed responses, such as
+	// signed UserInfo responses. If not set, a key set shared by the clients using the same
+	// jwks_uri is used.
+	KeySet *RemoteKeySet
+
+	// UserInfoSignedResponseAlg optionally contains the userinfo_signed_response_alg registered
+	// for the client. When set, UserInfo responses must be signed, and encrypted responses must
+	// contain a signed response rather than the plain claims.
+	UserInfoSignedResponseAlg string
+
+	// DecryptionKey optionally contains the private key, as a JSONWebKey, used to decrypt
+	// encrypted responses, such as encrypted UserInfo responses. When set, UserInfo responses
+	// must be encrypted. The KeyID and Algorithm are expected to be populated.
+	DecryptionKey *jose.JSONWebKey
+
+	// RequestObject optionally sends the authorization parameters of the browser flow and
+	// pushed authorization requests as a signed, and optionally encrypted, request object.
+	RequestObject *RequestObjectOptions
+
+	// DPoP optionally binds the tokens issued to the client to the key using DPoP proofs.
+	// Proofs are sent with every token request and the authorization code is bound to the
+	// key using the dpop_jkt parameter.
+	DPoP *DPoPKey
 }
 
 func (c *Client) TokenWithAPIClient(ctx context.Context, parameters url.Values) (*TokenResponse, error) {
@@ -47,44 +77,55 @@ func (c *Client) TokenWithAPIClient(ctx context.Context, parameters url.Values)
 		params.Add(k, parameters.Get(k))
 	}
 
+	tokenURL, err := c.endpoint(ctx, tokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
 	oauthConfig := &clientcredentials.Config{
 		ClientID:       clientID,
 		ClientSecret:   clientSecret,
-		TokenURL:       fmt.Sprintf("https://%s/oauth2/token", c.Tenant),
+		TokenURL:       tokenURL,
 		AuthStyle:      oauth2.AuthStyleInParams,
 		EndpointParams: params,
 		Scopes:         c.Scopes,
 	}
 
-	t, err := oauthConfig.Token(ctx)
+	ctx, err = c.oauth2Context(ctx, tokenEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
+	t, err := oauthConfig.Token(ctx)
+	if err != nil {
+		return nil, convertRetrieveError(err)
+	}
+
 	return NewTokenResponseWithOAuth2Token(t), nil
 }
 
 func (c *Client) AuthorizeWithBrowserFlow(ctx context.Context, parameters url.Values) (*AuthorizeResponse, error) {
-	params, err := c.ClientAuth.GetParameters()
+	params, authResponse, err := c.authorizationParameters(ctx, parameters)
 	if err != nil {
 		return nil, err
 	}
 
-	var opts []oauth2.AuthCodeOption
-	for k := range parameters {
-		opts = append(opts, oauth2.SetAuthURLParam(k, parameters.Get(k)))
+	authURL, err := c.endpoint(ctx, authorizationEndpoint)
+	if err != nil {
+		return nil, err
 	}
 
-	verifier := oauth2.GenerateVerifier()
-	opts = append(opts, oauth2.S256ChallengeOption(verifier))
+	authResponse.AuthCodeURL = buildURL(authURL, params)
+	return authResponse, nil
+}
 
-	oauthConfig := &oauth2.Config{
-		ClientID: params.Get("client_id"),
-		Endpoint: oauth2.Endpoint{
-			AuthURL: fmt.Sprintf("https://%s/oauth2/authorize", c.Tenant),
-		},
-		RedirectURL: c.RedirectURL,
-		Scopes:      c.Scopes,
+// authorizationParameters builds the parameters of the authorization request, including
+// the state, nonce and PKCE challenge, which are returned in the AuthorizeResponse. If
+// RequestObject is configured, the parameters are packaged into a request object.
+func (c *Client) authorizationParameters(ctx context.Context, parameters url.Values) (url.Values, *AuthorizeResponse, error) {
+	clientParams, err := c.ClientAuth.GetParameters()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	state, err := randx.GenerateRandomString(24, randx.AlphaLower)
@@ -93,22 +134,87 @@ func (c *Client) AuthorizeWithBrowserFlow(ctx context.Context, parameters url.Va
 		state = uuid.NewString()
 	}
 
-	return &AuthorizeResponse{
-		State:            state,
-		AuthCodeURL:      oauthConfig.AuthCodeURL(state, opts...),
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {clientParams.Get("client_id")},
+		"state":         {state},
+	}
+
+	if c.RedirectURL != "" {
+		params.Set("redirect_uri", c.RedirectURL)
+	}
+
+	if len(c.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	// repeated parameters, such as resource, are kept
+	for k, v := range parameters {
+		params[k] = v
+	}
+
+	nonce := params.Get("nonce")
+	if nonce == "" {
+		nonce, err = randx.GenerateRandomString(24, randx.AlphaLower)
+		if err != nil {
+			nonce = uuid.NewString()
+		}
+		params.Set("nonce", nonce)
+	}
+
+	if c.DPoP != nil {
+		jkt, err := c.DPoP.Thumbprint()
+		if err != nil {
+			return nil, nil, err
+		}
+		params.Set("dpop_jkt", jkt)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	params.Set("code_challenge_method", "S256")
+	params.Set("code_challenge", oauth2.S256ChallengeFromVerifier(verifier))
+
+	authResponse := &AuthorizeResponse{
+		State:            params.Get("state"),
 		PKCECodeVerifier: verifier,
-	}, nil
+		Nonce:            nonce,
+	}
+
+	if c.RequestObject != nil {
+		if params, err = c.requestObjectParameters(ctx, params); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return params, authResponse, nil
+}
+
+// buildURL appends the parameters to the query of the URL.
+func buildURL(base string, params url.Values) string {
+	if strings.Contains(base, "?") {
+		return base + "&" + params.Encode()
+	}
+
+	return base + "?" + params.Encode()
 }
 
+// TokenWithAuthCode validates the authorization response in the callback parameters and
+// exchanges the code for a token. Errors are returned as *OAuthError, so the error in the
+// authorization response, such as access_denied, can be checked using errors.Is. If the state
+// does not match, the error matches ErrStateMismatch.
 func (c *Client) TokenWithAuthCode(ctx context.Context, authResponse *AuthorizeResponse, callbackParams url.Values) (*TokenResponse, error) {
 	// verify if the flow has failed
-	if callbackParams.Get("error") != "" {
-		return nil, errorsx.G11NError("error: %s, description: %s", callbackParams.Get("error"), callbackParams.Get("error_description"))
+	if err := newCallbackError(callbackParams); err != nil {
+		return nil, err
 	}
 
 	// check if the state matches
 	if callbackParams.Get("state") != authResponse.State {
-		return nil, errorsx.G11NError("'state' does not match.")
+		return nil, &OAuthError{Code: ErrStateMismatch.Code, Description: "'state' does not match."}
+	}
+
+	if callbackParams.Get("code") == "" {
+		return nil, &OAuthError{Code: ErrInvalidRequest.Code, Description: "'code' is required."}
 	}
 
 	// do the biz
@@ -122,12 +228,16 @@ func (c *Client) TokenWithAuthCode(ctx context.Context, authResponse *AuthorizeR
 	clientSecret := params.Get("client_secret")
 	params.Del("client_secret")
 
+	tokenURL, err := c.endpoint(ctx, tokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
 	oauthConfig := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  fmt.Sprintf("https://%s/oauth2/authorize", c.Tenant),
-			TokenURL: fmt.Sprintf("https://%s/oauth2/token", c.Tenant),
+			TokenURL: tokenURL,
 		},
 		Scopes:      c.Scopes,
 		RedirectURL: c.RedirectURL,
@@ -141,11 +251,16 @@ func (c *Client) TokenWithAuthCode(ctx context.Context, authResponse *AuthorizeR
 	}
 
 	opts = append(opts, oauth2.VerifierOption(authResponse.PKCECodeVerifier))
-	t, err := oauthConfig.Exchange(ctx, callbackParams.Get("code"), opts...)
+	ctx, err = c.oauth2Context(ctx, tokenEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
+	t, err := oauthConfig.Exchange(ctx, callbackParams.Get("code"), opts...)
+	if err != nil {
+		return nil, convertRetrieveError(err)
+	}
+
 	return NewTokenResponseWithOAuth2Token(t), nil
 }
 
@@ -160,15 +275,30 @@ func (c *Client) AuthorizeWithDeviceFlow(ctx context.Context, parameters url.Val
 		opts = append(opts, oauth2.SetAuthURLParam(k, parameters.Get(k)))
 	}
 
+	deviceAuthURL, err := c.endpoint(ctx, deviceAuthorizationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
 	oauthConfig := &oauth2.Config{
 		ClientID: params.Get("client_id"),
 		Endpoint: oauth2.Endpoint{
-			DeviceAuthURL: fmt.Sprintf("https://%s/oauth2/device_authorization", c.Tenant),
+			DeviceAuthURL: deviceAuthURL,
 		},
 		Scopes: c.Scopes,
 	}
 
-	return oauthConfig.DeviceAuth(ctx, opts...)
+	ctx, err = c.oauth2Context(ctx, deviceAuthorizationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	authResponse, err := oauthConfig.DeviceAuth(ctx, opts...)
+	if err != nil {
+		return nil, convertRetrieveError(err)
+	}
+
+	return authResponse, nil
 }
 
 // TokenWithDeviceFlow polls for the token as part of the device authorization grant flow.
@@ -184,12 +314,16 @@ func (c *Client) TokenWithDeviceFlow(ctx context.Context, deviceAuthResponse *oa
 	clientSecret := params.Get("client_secret")
 	params.Del("client_secret")
 
+	tokenURL, err := c.endpoint(ctx, tokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
 	oauthConfig := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		Endpoint: oauth2.Endpoint{
-			DeviceAuthURL: fmt.Sprintf("https://%s/oauth2/device_authorization", c.Tenant),
-			TokenURL:      fmt.Sprintf("https://%s/oauth2/token", c.Tenant),
+			TokenURL: tokenURL,
 		},
 		Scopes: c.Scopes,
 	}
@@ -201,10 +335,47 @@ func (c *Client) TokenWithDeviceFlow(ctx context.Context, deviceAuthResponse *oa
 		}
 	}
 
-	t, err := oauthConfig.DeviceAccessToken(ctx, deviceAuthResponse, opts...)
+	ctx, err = c.oauth2Context(ctx, tokenEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
+	t, err := oauthConfig.DeviceAccessToken(ctx, deviceAuthResponse, opts...)
+	if err != nil {
+		return nil, convertRetrieveError(err)
+	}
+
 	return NewTokenResponseWithOAuth2Token(t), nil
 }
+
+// TokenWithRefreshToken redeems the refresh token for a new access token using the
+// refresh_token grant, authenticating with the configured ClientAuth.
+//
+// If the authorization server rotates refresh tokens, the returned TokenResponse contains
+// the new refresh token and the one presented must be discarded. Otherwise, the presented
+// refresh token is carried over to the returned TokenResponse. If the refresh token is no
+// longer valid, the error matches ErrInvalidGrant using errors.Is.
+func (c *Client) TokenWithRefreshToken(ctx context.Context, refreshToken string, parameters url.Values) (*TokenResponse, error) {
+	if refreshToken == "" {
+		return nil, errorsx.G11NError("'refreshToken' is required.")
+	}
+
+	params := url.Values{}
+	for k := range parameters {
+		params.Set(k, parameters.Get(k))
+	}
+
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", refreshToken)
+
+	t, err := c.tokenRequest(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+
+	return t, nil
+}
@@ -1,20 +1,125 @@
 package auth
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/go-jose/go-jose/v4"
 	"github.com/google/uuid"
 	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+const (
+	// ClientAuthMethodClientSecretBasic identifies the client_secret_basic authentication method.
+	ClientAuthMethodClientSecretBasic = "client_secret_basic"
+
+	// ClientAuthMethodClientSecretPost identifies the client_secret_post authentication method.
+	ClientAuthMethodClientSecretPost = "client_secret_post"
+
+	// ClientAuthMethodClientSecretJWT identifies the client_secret_jwt authentication method.
+	ClientAuthMethodClientSecretJWT = "client_secret_jwt"
+
+	// ClientAuthMethodPrivateKeyJWT identifies the private_key_jwt authentication method.
+	ClientAuthMethodPrivateKeyJWT = "private_key_jwt"
+
+	// ClientAuthMethodTLSClientAuth identifies the tls_client_auth authentication method.
+	ClientAuthMethodTLSClientAuth = "tls_client_auth"
+
+	// ClientAuthMethodSelfSignedTLSClientAuth identifies the self_signed_tls_client_auth
+	// authentication method.
+	ClientAuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
 )
 
 type ClientAuth interface {
 	GetParameters() (url.Values, error)
 }
 
+// HeaderClientAuth is implemented by client authentication methods that send HTTP headers,
+// such as the Authorization header, in addition to the parameters. The headers are added to
+// the requests sent to the token, device authorization, PAR, introspection and revocation
+// endpoints.
+type HeaderClientAuth interface {
+	ClientAuth
+
+	GetHeaders() (http.Header, error)
+}
+
+// SelectClientAuth returns the first of the candidates that uses an authentication method
+// advertised in the token_endpoint_auth_methods_supported of the discovery document. If the
+// document does not advertise any, client_secret_basic is assumed, as described in the
+// OpenID Connect Discovery specification.
+func SelectClientAuth(ctx context.Context, discovery *Discovery, candidates ...ClientAuth) (ClientAuth, error) {
+	config, err := discovery.Configuration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	supported := typesx.StringSlice(config.TokenEndpointAuthMethodsSupported)
+	if len(supported) == 0 {
+		supported = typesx.StringSlice{ClientAuthMethodClientSecretBasic}
+	}
+
+	for _, candidate := range candidates {
+		if supported.ContainsString(clientAuthMethod(candidate)) {
+			return candidate, nil
+		}
+	}
+
+	return nil, errorsx.G11NError("none of the client authentication methods are supported; supported=%v", []string(supported))
+}
+
+// clientAuthMethod returns the token_endpoint_auth_method value of the client authentication.
+func clientAuthMethod(ca ClientAuth) string {
+	switch ca.(type) {
+	case *ClientSecretBasic:
+		return ClientAuthMethodClientSecretBasic
+	case *ClientSecretPost:
+		return ClientAuthMethodClientSecretPost
+	case *ClientSecretJWT:
+		return ClientAuthMethodClientSecretJWT
+	case *PrivateKeyJWT:
+		return ClientAuthMethodPrivateKeyJWT
+	case *TLSClientAuth:
+		return ClientAuthMethodTLSClientAuth
+	case *SelfSignedTLSClientAuth:
+		return ClientAuthMethodSelfSignedTLSClientAuth
+	}
+
+	return ""
+}
+
+type ClientSecretBasic struct {
+	// ClientID contains the client_id of the application or API client configured
+	// to use this client authentication method.
+	ClientID string
+
+	// ClientSecret contains the client_secret of the application or API client configured
+	// to use this client authentication method.
+	ClientSecret string
+}
+
+// GetParameters returns the client_id, which is needed to identify the client in requests
+// that are not authenticated, such as the authorization request.
+func (c *ClientSecretBasic) GetParameters() (url.Values, error) {
+	return url.Values{"client_id": {c.ClientID}}, nil
+}
+
+// GetHeaders returns the Authorization header using the HTTP Basic authentication scheme.
+// The credentials are form-encoded before being combined, as described in RFC 6749.
+func (c *ClientSecretBasic) GetHeaders() (http.Header, error) {
+	req := &http.Request{Header: http.Header{}}
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	return req.Header, nil
+}
+
 type ClientSecretPost struct {
 	// ClientID contains the client_id of the application or API client configured
 	// to use this client authentication method.
@@ -52,57 +157,238 @@ type PrivateKeyJWT struct {
 	// The KeyID and Algorithm are expected to be populated.
 	PrivateKeyJWK *jose.JSONWebKey
 
+	// Keys optionally provides the private key, such as a KeyManager that rotates keys.
+	// When set, the current key is used for each assertion instead of PrivateKeyJWK.
+	Keys SigningKeySource
+
 	// Expires optionally specifies how long the token is valid for. By default, this is
 	// set to 30 mins.
 	Expires time.Duration
 }
 
 func (c *PrivateKeyJWT) GetParameters() (url.Values, error) {
-	// generate the JWT
-	expires := c.Expires
-	if c.Expires == 0 {
+	key := c.PrivateKeyJWK
+	if c.Keys != nil {
+		var err error
+		if key, err = c.Keys.SigningKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	return clientAssertionParameters(c.Tenant, c.ClientID, c.Expires, key)
+}
+
+type ClientSecretJWT struct {
+	// Tenant contains the hostname of the authorization server provided by Verify.
+	// This value is expected to be just the hostname and not the scheme or path.
+	// Example:
+	//
+	// 		abc.verify.ibm.com
+	Tenant string
+
+	// ClientID contains the client_id of the application or API client configured
+	// to use this client authentication method.
+	ClientID string
+
+	// ClientSecret contains the client_secret used as the key to sign the client assertion.
+	ClientSecret string
+
+	// Algorithm optionally specifies the HMAC algorithm used to sign the client assertion,
+	// which is one of HS256, HS384 or HS512. By default, this is set to HS256.
+	Algorithm jose.SignatureAlgorithm
+
+	// Expires optionally specifies how long the token is valid for. By default, this is
+	// set to 30 mins.
+	Expires time.Duration
+}
+
+func (c *ClientSecretJWT) GetParameters() (url.Values, error) {
+	alg := c.Algorithm
+	if alg == "" {
+		alg = jose.HS256
+	}
+
+	switch alg {
+	case jose.HS256, jose.HS384, jose.HS512:
+	default:
+		return nil, errorsx.G11NError("the algorithm '%s' is not supported for client_secret_jwt", alg)
+	}
+
+	key := &jose.JSONWebKey{
+		Key:       []byte(c.ClientSecret),
+		Algorithm: string(alg),
+	}
+
+	return clientAssertionParameters(c.Tenant, c.ClientID, c.Expires, key)
+}
+
+// clientAssertionParameters signs a client assertion using the key and returns the
+// parameters used to authenticate with it, as described in RFC 7523.
+func clientAssertionParameters(tenant string, clientID string, expires time.Duration, key *jose.JSONWebKey) (url.Values, error) {
+	if expires == 0 {
 		expires = 30 * time.Minute
 	}
 
-	claims := map[string]any{
-		"iss": c.ClientID,
-		"sub": c.ClientID,
-		"aud": []string{
-			fmt.Sprintf("https://%s/oauth2", c.Tenant),
-			fmt.Sprintf("https://%s/oauth2/token", c.Tenant),
-		},
-		"exp": time.Now().UTC().Add(expires).Unix(),
-		"iat": time.Now().UTC().Unix(),
+	claims := assertionClaims(clientID, clientID, []string{
+		fmt.Sprintf("https://%s/oauth2", tenant),
+		fmt.Sprintf("https://%s/oauth2/token", tenant),
+	}, expires)
+
+	token, err := signJWT(key, "JWT", claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// add the parameters
+	ret := url.Values{}
+	ret.Add("client_id", clientID)
+	ret.Add("client_assertion_type", clientAssertionType)
+	ret.Add("client_assertion", token)
+
+	return ret, nil
+}
+
+// TLSClientAuth authenticates the client using a certificate issued by a trusted certificate
+// authority (tls_client_auth), as described in RFC 8705. When this is configured, the client
+// certificate is presented on the TLS connection and the mutual-TLS endpoint aliases from the
+// discovery document are used, if advertised.
+type TLSClientAuth struct {
+	// ClientID contains the client_id of the application or API client configured
+	// to use this client authentication method.
+	ClientID string
+
+	// Certificate contains the client certificate and private key presented to the
+	// authorization server.
+	Certificate tls.Certificate
+}
+
+func (c *TLSClientAuth) GetParameters() (url.Values, error) {
+	return url.Values{"client_id": {c.ClientID}}, nil
+}
+
+func (c *TLSClientAuth) clientCertificate() tls.Certificate {
+	return c.Certificate
+}
+
+// SelfSignedTLSClientAuth authenticates the client using a self-signed certificate registered
+// with the application (self_signed_tls_client_auth), as described in RFC 8705.
+type SelfSignedTLSClientAuth struct {
+	// ClientID contains the client_id of the application or API client configured
+	// to use this client authentication method.
+	ClientID string
+
+	// Certificate contains the self-signed client certificate and private key presented to
+	// the authorization server.
+	Certificate tls.Certificate
+}
+
+func (c *SelfSignedTLSClientAuth) GetParameters() (url.Values, error) {
+	return url.Values{"client_id": {c.ClientID}}, nil
+}
+
+func (c *SelfSignedTLSClientAuth) clientCertificate() tls.Certificate {
+	return c.Certificate
+}
+
+// certificateClientAuth is implemented by the client authentication methods that present a
+// client certificate on the TLS connection.
+type certificateClientAuth interface {
+	clientCertificate() tls.Certificate
+}
+
+// headerTransport adds the client authentication headers to each request, replacing any
+// set by golang.org/x/oauth2.
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// withHeaders returns a copy of the http.Client that adds the headers to each request.
+func withHeaders(hc *http.Client, header http.Header) *http.Client {
+	base := hc.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ret := *hc
+	ret.Transport = &headerTransport{base: base, header: header}
+	return &ret
+}
+
+// withClientCertificate returns a copy of the http.Client that presents the certificate. The
+// transport of the client is expected to be an *http.Transport.
+func withClientCertificate(hc *http.Client, cert tls.Certificate) (*http.Client, error) {
+	base := hc.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errorsx.G11NError("the client certificate cannot be configured on the transport '%T'", base)
+	}
+
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+
+	t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+	ret := *hc
+	ret.Transport = t
+	return &ret, nil
+}
+
+// assertionClaims returns the claims of a JWT assertion, as described in RFC 7523.
+func assertionClaims(issuer string, subject string, audience []string, expires time.Duration) map[string]any {
+	now := time.Now().UTC()
+	return map[string]any{
+		"iss": issuer,
+		"sub": subject,
+		"aud": audience,
+		"exp": now.Add(expires).Unix(),
+		"iat": now.Unix(),
 		"jti": uuid.NewString(),
 	}
+}
+
+// signJWT signs the claims using the private key, setting the typ header.
+func signJWT(key *jose.JSONWebKey, typ string, claims any) (string, error) {
+	if key == nil {
+		return "", errorsx.G11NError("the signing key is not set")
+	}
 
 	h := map[jose.HeaderKey]any{
-		jose.HeaderKey("alg"): c.PrivateKeyJWK.Algorithm,
-		jose.HeaderKey("typ"): "JWT",
+		jose.HeaderKey("alg"): key.Algorithm,
+		jose.HeaderKey("typ"): typ,
 	}
 
 	var token string
 	if signer, err := jose.NewSigner(
 		jose.SigningKey{
-			Algorithm: jose.SignatureAlgorithm(c.PrivateKeyJWK.Algorithm),
-			Key:       c.PrivateKeyJWK,
+			Algorithm: jose.SignatureAlgorithm(key.Algorithm),
+			Key:       key,
 		}, &jose.SignerOptions{
 			ExtraHeaders: h,
 		}); err != nil {
-		return nil, err
+		return "", err
 	} else if pbytes, err := json.Marshal(claims); err != nil {
-		return nil, errorsx.G11NError("marshaling claims failed; err= %v", err)
+		return "", errorsx.G11NError("marshaling claims failed; err= %v", err)
 	} else if o, err := signer.Sign(pbytes); err != nil {
-		return nil, err
+		return "", err
 	} else if token, err = o.CompactSerialize(); err != nil {
-		return nil, err
+		return "", err
 	}
 
-	// add the parameters
-	ret := url.Values{}
-	ret.Add("client_id", c.ClientID)
-	ret.Add("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
-	ret.Add("client_assertion", token)
-
-	return ret, nil
+	return token, nil
 }
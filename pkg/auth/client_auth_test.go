@@ -0,0 +1,268 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type ClientAuthTestSuite struct {
+	suite.Suite
+
+	ctx     context.Context
+	server  *httptest.Server
+	tenant  string
+	methods []string
+	handler func(w http.ResponseWriter, r *http.Request)
+}
+
+func (s *ClientAuthTestSuite) SetupTest() {
+	s.methods = nil
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth2"+auth.DiscoveryEndpoint {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"issuer":                                s.server.URL + "/oauth2",
+				"token_endpoint_auth_methods_supported": s.methods,
+			})
+			return
+		}
+
+		_ = r.ParseForm()
+		s.handler(w, r)
+	}))
+
+	s.tenant = strings.TrimPrefix(s.server.URL, "https://")
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+}
+
+func (s *ClientAuthTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *ClientAuthTestSuite) writeToken(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   7200,
+	})
+}
+
+func (s *ClientAuthTestSuite) TestClientSecretBasic() {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		require.True(s.T(), ok, "the credentials must be sent using HTTP Basic authentication")
+		require.Equal(s.T(), "client%3AID", clientID)
+		require.Equal(s.T(), "secret", clientSecret)
+		require.Empty(s.T(), r.PostForm.Get("client_secret"))
+		s.writeToken(w)
+	}
+
+	client := &auth.Client{
+		Tenant: s.tenant,
+		ClientAuth: &auth.ClientSecretBasic{
+			ClientID:     "client:ID",
+			ClientSecret: "secret",
+		},
+	}
+
+	_, err := client.TokenWithAPIClient(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to get a token using the client credentials grant")
+
+	_, err = client.TokenWithRefreshToken(s.ctx, "refresh", nil)
+	require.NoError(s.T(), err, "unable to refresh the token")
+}
+
+func (s *ClientAuthTestSuite) TestClientSecretJWT() {
+	secret := strings.Repeat("s", 64)
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(s.T(), "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", r.PostForm.Get("client_assertion_type"))
+
+		token, err := jwt.ParseSigned(r.PostForm.Get("client_assertion"), []jose.SignatureAlgorithm{jose.HS512})
+		require.NoError(s.T(), err, "unable to parse the client assertion")
+
+		claims := jwt.Claims{}
+		require.NoError(s.T(), token.Claims([]byte(secret), &claims), "unable to verify the client assertion")
+		require.Equal(s.T(), "clientID", claims.Subject)
+		require.Contains(s.T(), claims.Audience, s.server.URL+"/oauth2/token")
+		s.writeToken(w)
+	}
+
+	client := &auth.Client{
+		Tenant: s.tenant,
+		ClientAuth: &auth.ClientSecretJWT{
+			Tenant:       s.tenant,
+			ClientID:     "clientID",
+			ClientSecret: secret,
+			Algorithm:    jose.HS512,
+		},
+	}
+
+	_, err := client.TokenWithRefreshToken(s.ctx, "refresh", nil)
+	require.NoError(s.T(), err, "unable to refresh the token")
+
+	client.ClientAuth = &auth.ClientSecretJWT{ClientID: "clientID", ClientSecret: secret, Algorithm: jose.RS256}
+	_, err = client.TokenWithRefreshToken(s.ctx, "refresh", nil)
+	require.Error(s.T(), err, "only HMAC algorithms should be accepted")
+}
+
+func (s *ClientAuthTestSuite) TestPrivateKeyJWTWithKeyManager() {
+	manager, err := auth.NewKeyManager(nil, nil, &auth.KeyManagerOptions{Overlap: 50 * time.Millisecond})
+	require.NoError(s.T(), err, "unable to create the key manager")
+
+	// fetchJWKS returns the key set published by the key manager, as the tenant would
+	fetchJWKS := func() *jose.JSONWebKeySet {
+		w := httptest.NewRecorder()
+		manager.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jwks", nil))
+		require.Equal(s.T(), http.StatusOK, w.Code)
+
+		jwks := &jose.JSONWebKeySet{}
+		require.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), jwks), "unable to parse the JWKS")
+		for _, k := range jwks.Keys {
+			require.True(s.T(), k.IsPublic(), "only public keys should be published")
+		}
+
+		return jwks
+	}
+
+	var kids []string
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		token, err := jwt.ParseSigned(r.PostForm.Get("client_assertion"), []jose.SignatureAlgorithm{jose.RS256})
+		require.NoError(s.T(), err, "unable to parse the client assertion")
+
+		kid := token.Headers[0].KeyID
+		keys := fetchJWKS().Key(kid)
+		require.Len(s.T(), keys, 1, "the signing key should be published")
+
+		claims := jwt.Claims{}
+		require.NoError(s.T(), token.Claims(keys[0].Key, &claims), "unable to verify the client assertion")
+		kids = append(kids, kid)
+		s.writeToken(w)
+	}
+
+	client := &auth.Client{
+		Tenant: s.tenant,
+		ClientAuth: &auth.PrivateKeyJWT{
+			Tenant:   s.tenant,
+			ClientID: "clientID",
+			Keys:     manager,
+		},
+	}
+
+	initial, err := manager.SigningKey()
+	require.NoError(s.T(), err, "unable to get the signing key")
+	next := manager.NextKey()
+	require.Len(s.T(), fetchJWKS().Keys, 2, "the active and next keys should be published")
+
+	_, err = client.TokenWithAPIClient(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to get a token")
+
+	require.NoError(s.T(), manager.Rotate(), "unable to rotate the keys")
+	require.Len(s.T(), fetchJWKS().Keys, 3, "the retired key should be published during the overlap")
+
+	_, err = client.TokenWithAPIClient(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to get a token")
+	require.Equal(s.T(), []string{initial.KeyID, next.KeyID}, kids, "the rotated key should be used")
+
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(s.T(), fetchJWKS().Key(initial.KeyID), "the retired key should be removed after the overlap")
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	manager.RotationInterval = 10 * time.Millisecond
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	require.ErrorIs(s.T(), manager.Run(ctx), context.Canceled)
+
+	rotated, err := manager.SigningKey()
+	require.NoError(s.T(), err, "unable to get the signing key")
+	require.NotEqual(s.T(), next.KeyID, rotated.KeyID, "the keys should be rotated on schedule")
+}
+
+func (s *ClientAuthTestSuite) TestKeyManagerOptions() {
+	generateKey := func() (*jose.JSONWebKey, error) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return &jose.JSONWebKey{Key: key, Algorithm: string(jose.ES256)}, nil
+	}
+
+	active, err := generateKey()
+	require.NoError(s.T(), err, "unable to generate a key")
+
+	type rotation struct {
+		active    *jose.JSONWebKey
+		next      *jose.JSONWebKey
+		rotatedAt time.Time
+	}
+
+	rotations := make(chan rotation, 1)
+	rotatedAt := time.Now().Add(-2 * time.Hour)
+	manager, err := auth.NewKeyManager(active, nil, &auth.KeyManagerOptions{
+		RotationInterval: time.Hour,
+		GenerateKey:      generateKey,
+		RotatedAt:        rotatedAt,
+		OnRotate: func(active *jose.JSONWebKey, next *jose.JSONWebKey, rotatedAt time.Time) error {
+			rotations <- rotation{active: active, next: next, rotatedAt: rotatedAt}
+			return nil
+		},
+	})
+	require.NoError(s.T(), err, "unable to create the key manager")
+	require.Equal(s.T(), string(jose.ES256), manager.NextKey().Algorithm, "the generator should be used for the initial keys")
+	require.True(s.T(), rotatedAt.Equal(manager.RotatedAt()))
+
+	// the active key is older than the rotation interval, so it is rotated immediately
+	next := manager.NextKey()
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	go func() { _ = manager.Run(ctx) }()
+
+	select {
+	case r := <-rotations:
+		require.Equal(s.T(), next.KeyID, r.active.KeyID)
+		require.Equal(s.T(), string(jose.ES256), r.next.Algorithm)
+		require.WithinDuration(s.T(), time.Now(), r.rotatedAt, time.Minute)
+	case <-time.After(5 * time.Second):
+		s.T().Fatal("the keys should be rotated when the schedule has passed")
+	}
+}
+
+func (s *ClientAuthTestSuite) TestSelectClientAuth() {
+	post := &auth.ClientSecretPost{ClientID: "clientID", ClientSecret: "secret"}
+	basic := &auth.ClientSecretBasic{ClientID: "clientID", ClientSecret: "secret"}
+	secretJWT := &auth.ClientSecretJWT{Tenant: s.tenant, ClientID: "clientID", ClientSecret: "secret"}
+
+	s.methods = []string{"client_secret_jwt", "client_secret_post"}
+	selected, err := auth.SelectClientAuth(s.ctx, auth.NewDiscovery(s.tenant), basic, post, secretJWT)
+	require.NoError(s.T(), err, "unable to select the client authentication")
+	require.Same(s.T(), post, selected)
+
+	// client_secret_basic is the default
+	s.methods = nil
+	selected, err = auth.SelectClientAuth(s.ctx, auth.NewDiscovery(s.tenant), post, basic)
+	require.NoError(s.T(), err, "unable to select the client authentication")
+	require.Same(s.T(), basic, selected)
+
+	_, err = auth.SelectClientAuth(s.ctx, auth.NewDiscovery(s.tenant), post)
+	require.Error(s.T(), err, "an unsupported method should not be selected")
+}
+
+func TestClientAuthTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientAuthTestSuite))
+}
@@ -0,0 +1,873 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type ClientTestSuite struct {
+	suite.Suite
+
+	ctx     context.Context
+	server  *httptest.Server
+	client  *auth.Client
+	handler func(w http.ResponseWriter, r *http.Request)
+}
+
+func (s *ClientTestSuite) SetupTest() {
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		s.handler(w, r)
+	}))
+
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+	s.client = &auth.Client{
+		Tenant: strings.TrimPrefix(s.server.URL, "https://"),
+		ClientAuth: &auth.ClientSecretPost{
+			ClientID:     "clientID",
+			ClientSecret: "clientSecret",
+		},
+	}
+}
+
+func (s *ClientTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *ClientTestSuite) TestRefreshTokenRotation() {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(s.T(), "refresh_token", r.PostForm.Get("grant_type"))
+		require.Equal(s.T(), "clientSecret", r.PostForm.Get("client_secret"))
+
+		resp := map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   7200,
+		}
+		if r.PostForm.Get("refresh_token") == "rotate" {
+			resp["refresh_token"] = "rotated"
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+
+	t, err := s.client.TokenWithRefreshToken(s.ctx, "rotate", nil)
+	require.NoError(s.T(), err, "unable to refresh the token")
+	require.Equal(s.T(), "rotated", t.RefreshToken)
+	require.False(s.T(), t.Expiry.IsZero(), "expiry should be computed")
+
+	t, err = s.client.TokenWithRefreshToken(s.ctx, "keep", nil)
+	require.NoError(s.T(), err, "unable to refresh the token")
+	require.Equal(s.T(), "keep", t.RefreshToken)
+}
+
+func (s *ClientTestSuite) TestRefreshTokenInvalidGrant() {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":             "invalid_grant",
+			"error_description": "The refresh token is expired.",
+		})
+	}
+
+	_, err := s.client.TokenWithRefreshToken(s.ctx, "expired", nil)
+	require.ErrorIs(s.T(), err, auth.ErrInvalidGrant)
+
+	var oauthErr *auth.OAuthError
+	require.True(s.T(), errors.As(err, &oauthErr))
+	require.Equal(s.T(), http.StatusBadRequest, oauthErr.StatusCode)
+	require.Equal(s.T(), "The refresh token is expired.", oauthErr.Description)
+}
+
+func (s *ClientTestSuite) TestOAuthErrors() {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			if r.PostForm.Get("grant_type") == "client_credentials" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="verify"`)
+				writeJSON(w, http.StatusUnauthorized, map[string]any{
+					"error":             "invalid_client",
+					"error_description": "The client is not known.",
+				})
+				return
+			}
+
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+		case "/oauth2/device_authorization":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("unavailable"))
+		case "/oauth2/userinfo":
+			w.Header().Add("WWW-Authenticate", `DPoP algs="ES256 PS256"`)
+			w.Header().Add("WWW-Authenticate", `Bearer realm="verify", error="invalid_token", error_description="The token is \"expired\"."`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}
+
+	var oauthErr *auth.OAuthError
+	_, err := s.client.TokenWithAPIClient(s.ctx, nil)
+	require.ErrorIs(s.T(), err, auth.ErrInvalidClient)
+	require.True(s.T(), errors.As(err, &oauthErr))
+	require.Equal(s.T(), http.StatusUnauthorized, oauthErr.StatusCode)
+	require.Equal(s.T(), "The client is not known.", oauthErr.Description)
+	require.Equal(s.T(), "Basic", oauthErr.Challenges[0].Scheme)
+	require.Equal(s.T(), "verify", oauthErr.Challenges[0].Params["realm"])
+
+	authResponse := &auth.AuthorizeResponse{State: "state", PKCECodeVerifier: oauth2.GenerateVerifier()}
+	_, err = s.client.TokenWithAuthCode(s.ctx, authResponse, url.Values{
+		"error":             {"access_denied"},
+		"error_description": {"The user denied the request."},
+		"error_uri":         {"https://example.com/denied"},
+		"state":             {"state"},
+	})
+	require.ErrorIs(s.T(), err, auth.ErrAccessDenied)
+	require.True(s.T(), errors.As(err, &oauthErr))
+	require.Equal(s.T(), "https://example.com/denied", oauthErr.URI)
+
+	_, err = s.client.TokenWithAuthCode(s.ctx, authResponse, url.Values{"code": {"abc"}, "state": {"other"}})
+	require.ErrorIs(s.T(), err, auth.ErrStateMismatch)
+
+	_, err = s.client.TokenWithAuthCode(s.ctx, authResponse, url.Values{"state": {"state"}})
+	require.ErrorIs(s.T(), err, auth.ErrInvalidRequest)
+
+	_, err = s.client.TokenWithAuthCode(s.ctx, authResponse, url.Values{"code": {"abc"}, "state": {"state"}})
+	require.ErrorIs(s.T(), err, auth.ErrInvalidGrant)
+	require.True(s.T(), errors.As(err, &oauthErr))
+	require.Equal(s.T(), http.StatusBadRequest, oauthErr.StatusCode)
+
+	_, err = s.client.AuthorizeWithDeviceFlow(s.ctx, nil)
+	require.True(s.T(), errors.As(err, &oauthErr))
+	require.Equal(s.T(), http.StatusInternalServerError, oauthErr.StatusCode)
+	require.Empty(s.T(), oauthErr.Code)
+	require.Equal(s.T(), "unavailable", oauthErr.Description)
+
+	_, err = s.client.UserInfoWithTokenResponse(s.ctx, &auth.TokenResponse{AccessToken: "access"})
+	require.ErrorIs(s.T(), err, auth.ErrInvalidToken)
+	require.True(s.T(), errors.As(err, &oauthErr))
+	require.Equal(s.T(), `The token is "expired".`, oauthErr.Description)
+	require.Len(s.T(), oauthErr.Challenges, 2)
+	require.Equal(s.T(), "ES256 PS256", oauthErr.Challenges[0].Params["algs"])
+}
+
+func (s *ClientTestSuite) TestParseWWWAuthenticate() {
+	challenges := auth.ParseWWWAuthenticate(`Basic dXNlcg==, Bearer realm="a, b", error=invalid_token,DPoP algs="ES256", error="use_dpop_nonce"`)
+	require.Len(s.T(), challenges, 3)
+	require.Equal(s.T(), "Basic", challenges[0].Scheme)
+	require.Empty(s.T(), challenges[0].Params)
+	require.Equal(s.T(), map[string]string{"realm": "a, b", "error": "invalid_token"}, challenges[1].Params)
+	require.Equal(s.T(), "DPoP", challenges[2].Scheme)
+	require.Equal(s.T(), "use_dpop_nonce", challenges[2].Params["error"])
+	require.Empty(s.T(), auth.ParseWWWAuthenticate(""))
+}
+
+func (s *ClientTestSuite) TestIntrospectAndRevoke() {
+	revoked := false
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(s.T(), "clientID", r.PostForm.Get("client_id"))
+		switch r.URL.Path {
+		case "/oauth2/introspect":
+			if revoked {
+				writeJSON(w, http.StatusOK, map[string]any{"active": false})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{
+				"active":    true,
+				"sub":       "user",
+				"aud":       "clientID",
+				"exp":       1700000000,
+				"tenant_id": "abc",
+			})
+		case "/oauth2/revoke":
+			require.Equal(s.T(), auth.TokenTypeHintAccessToken, r.PostForm.Get("token_type_hint"))
+			revoked = true
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+
+	res, err := s.client.IntrospectToken(s.ctx, "access", auth.TokenTypeHintAccessToken)
+	require.NoError(s.T(), err, "unable to introspect the token")
+	require.True(s.T(), res.Active)
+	require.Equal(s.T(), "user", res.Subject)
+	require.Equal(s.T(), []string{"clientID"}, res.Audience)
+	require.EqualValues(s.T(), 1700000000, res.ExpiresAt)
+	require.Equal(s.T(), "abc", res.Claims.SafeString("tenant_id", ""))
+
+	err = s.client.RevokeToken(s.ctx, "access", auth.TokenTypeHintAccessToken)
+	require.NoError(s.T(), err, "unable to revoke the token")
+
+	res, err = s.client.IntrospectToken(s.ctx, "access", "")
+	require.NoError(s.T(), err, "unable to introspect the token")
+	require.False(s.T(), res.Active)
+}
+
+func (s *ClientTestSuite) TestUserInfo() {
+	signingKey := newSigningKey(s.T(), "sig")
+	encKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(s.T(), err, "unable to generate a key")
+	s.client.DecryptionKey = &jose.JSONWebKey{Key: encKey, KeyID: "enc", Algorithm: string(jose.RSA_OAEP_256)}
+
+	mode := ""
+	jwksRequests := 0
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/jwks":
+			jwksRequests++
+			writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{signingKey.Public()}})
+		case "/oauth2/userinfo":
+			require.Equal(s.T(), "Bearer access", r.Header.Get("Authorization"))
+			claims := map[string]any{"sub": "user", "email": "user@example.com", "aud": "clientID"}
+			if mode == "json" {
+				writeJSON(w, http.StatusOK, claims)
+				return
+			}
+
+			if mode == "signed" {
+				w.Header().Set("Content-Type", "application/jwt")
+				_, _ = w.Write([]byte(signJWT(s.T(), signingKey, claims)))
+				return
+			}
+
+			payload, err := json.Marshal(claims)
+			require.NoError(s.T(), err, "unable to marshal the claims")
+			if mode == "jwt" {
+				payload = []byte(signJWT(s.T(), signingKey, claims))
+			}
+
+			encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &encKey.PublicKey}, (&jose.EncrypterOptions{}).WithContentType("JWT"))
+			require.NoError(s.T(), err, "unable to create an encrypter")
+			jwe, err := encrypter.Encrypt(payload)
+			require.NoError(s.T(), err, "unable to encrypt")
+			raw, err := jwe.CompactSerialize()
+			require.NoError(s.T(), err, "unable to serialize")
+
+			w.Header().Set("Content-Type", "application/jwt")
+			_, _ = w.Write([]byte(raw))
+		}
+	}
+
+	for _, mode = range []string{"encrypted-json", "jwt", "jwt"} {
+		userInfo, err := s.client.UserInfoWithTokenResponse(s.ctx, &auth.TokenResponse{AccessToken: "access"})
+		require.NoError(s.T(), err, "unable to get the %s UserInfo response", mode)
+		require.Equal(s.T(), "user", userInfo.Subject())
+		require.Equal(s.T(), "user@example.com", userInfo.Email())
+	}
+
+	require.Equal(s.T(), 1, jwksRequests, "the key set must be cached")
+
+	for _, mode = range []string{"json", "signed"} {
+		_, err := s.client.UserInfo(s.ctx, "access")
+		require.Error(s.T(), err, "the %s UserInfo response must be rejected when a decryption key is set", mode)
+	}
+
+	decryptionKey := s.client.DecryptionKey
+	s.client.DecryptionKey = nil
+	for _, mode = range []string{"json", "signed"} {
+		userInfo, err := s.client.UserInfo(s.ctx, "access")
+		require.NoError(s.T(), err, "unable to get the %s UserInfo response", mode)
+		require.Equal(s.T(), "user", userInfo.Subject())
+	}
+
+	s.client.DecryptionKey = decryptionKey
+
+	s.client.UserInfoSignedResponseAlg = string(jose.RS256)
+	for _, mode = range []string{"json", "encrypted-json"} {
+		_, err := s.client.UserInfo(s.ctx, "access")
+		require.Error(s.T(), err, "the %s UserInfo response must be rejected when signed responses are registered", mode)
+	}
+
+	mode = "jwt"
+	_, err = s.client.UserInfo(s.ctx, "access")
+	require.NoError(s.T(), err, "unable to get the signed UserInfo response")
+}
+
+func (s *ClientTestSuite) TestBrowserFlow() {
+	s.client.RedirectURL = "https://app.example.com/callback"
+	s.client.Scopes = []string{"openid", "profile"}
+
+	authResponse, err := s.client.AuthorizeWithBrowserFlow(s.ctx, url.Values{"prompt": {"login"}})
+	require.NoError(s.T(), err, "unable to build the authorization URL")
+
+	u, err := url.Parse(authResponse.AuthCodeURL)
+	require.NoError(s.T(), err, "invalid authorization URL")
+	q := u.Query()
+	require.Equal(s.T(), "/oauth2/authorize", u.Path)
+	require.Equal(s.T(), "code", q.Get("response_type"))
+	require.Equal(s.T(), "clientID", q.Get("client_id"))
+	require.Equal(s.T(), "openid profile", q.Get("scope"))
+	require.Equal(s.T(), "login", q.Get("prompt"))
+	require.Equal(s.T(), authResponse.State, q.Get("state"))
+	require.Equal(s.T(), authResponse.Nonce, q.Get("nonce"))
+	require.Equal(s.T(), oauth2.S256ChallengeFromVerifier(authResponse.PKCECodeVerifier), q.Get("code_challenge"))
+	require.Empty(s.T(), q.Get("client_secret"), "the secret must not be sent in the front channel")
+}
+
+func (s *ClientTestSuite) TestBrowserFlowWithRequestObject() {
+	signingKey := newSigningKey(s.T(), "jar")
+	s.client.RequestObject = &auth.RequestObjectOptions{SigningKey: &signingKey}
+	s.client.Scopes = []string{"openid"}
+
+	authResponse, err := s.client.AuthorizeWithBrowserFlow(s.ctx, url.Values{
+		"acr_values": {"urn:ibm:security:policy:id:1"},
+		"claims":     {`{"id_token":{"email":{"essential":true}}}`},
+		"max_age":    {"300"},
+		"resource":   {"https://api1.example.com", "https://api2.example.com"},
+	})
+	require.NoError(s.T(), err, "unable to build the authorization URL")
+
+	u, err := url.Parse(authResponse.AuthCodeURL)
+	require.NoError(s.T(), err, "invalid authorization URL")
+	q := u.Query()
+	require.Empty(s.T(), q.Get("state"), "the parameters must only be in the request object")
+	require.Equal(s.T(), "clientID", q.Get("client_id"))
+
+	token, err := jwt.ParseSigned(q.Get("request"), []jose.SignatureAlgorithm{jose.RS256})
+	require.NoError(s.T(), err, "unable to parse the request object")
+	require.Equal(s.T(), auth.RequestObjectType, token.Headers[0].ExtraHeaders[jose.HeaderType])
+
+	claims := map[string]any{}
+	require.NoError(s.T(), token.Claims(signingKey.Public(), &claims), "unable to verify the request object")
+	require.Equal(s.T(), authResponse.State, claims["state"])
+	require.Equal(s.T(), "urn:ibm:security:policy:id:1", claims["acr_values"])
+	require.Equal(s.T(), "clientID", claims["iss"])
+	require.Equal(s.T(), s.server.URL+"/oauth2", claims["aud"])
+	require.Equal(s.T(), oauth2.S256ChallengeFromVerifier(authResponse.PKCECodeVerifier), claims["code_challenge"])
+	require.Equal(s.T(), map[string]any{"id_token": map[string]any{"email": map[string]any{"essential": true}}}, claims["claims"], "the claims should be a JSON object")
+	require.Equal(s.T(), float64(300), claims["max_age"], "max_age should be a number")
+	require.Equal(s.T(), []any{"https://api1.example.com", "https://api2.example.com"}, claims["resource"], "repeated parameters should be kept")
+
+	_, err = s.client.AuthorizeWithBrowserFlow(s.ctx, url.Values{"max_age": {"5m"}})
+	require.Error(s.T(), err, "max_age should be an integer")
+}
+
+func (s *ClientTestSuite) TestPushedAuthorizationRequest() {
+	var pushed url.Values
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(s.T(), "/oauth2/par", r.URL.Path)
+		pushed = r.PostForm
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"request_uri": "urn:ietf:params:oauth:request_uri:abc",
+			"expires_in":  60,
+		})
+	}
+
+	authResponse, err := s.client.AuthorizeWithPushedAuthorizationRequest(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to push the authorization request")
+	require.Equal(s.T(), "clientSecret", pushed.Get("client_secret"))
+	require.Equal(s.T(), oauth2.S256ChallengeFromVerifier(authResponse.PKCECodeVerifier), pushed.Get("code_challenge"))
+	require.Equal(s.T(), authResponse.State, pushed.Get("state"))
+	require.WithinDuration(s.T(), time.Now().Add(time.Minute), authResponse.RequestURIExpiry, 5*time.Second)
+
+	u, err := url.Parse(authResponse.AuthCodeURL)
+	require.NoError(s.T(), err, "invalid authorization URL")
+	require.Equal(s.T(), url.Values{
+		"client_id":   {"clientID"},
+		"request_uri": {"urn:ietf:params:oauth:request_uri:abc"},
+	}, u.Query())
+}
+
+func (s *ClientTestSuite) TestTokenExchange() {
+	s.client.Scopes = []string{"read", "write"}
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(s.T(), "urn:ietf:params:oauth:grant-type:token-exchange", r.PostForm.Get("grant_type"))
+		require.Equal(s.T(), "subject", r.PostForm.Get("subject_token"))
+		require.Equal(s.T(), string(auth.TokenTypeAccessToken), r.PostForm.Get("subject_token_type"))
+		require.Equal(s.T(), "actor", r.PostForm.Get("actor_token"))
+		require.Equal(s.T(), string(auth.TokenTypeJWT), r.PostForm.Get("actor_token_type"))
+		require.Equal(s.T(), []string{"https://api1.example.com", "https://api2.example.com"}, r.PostForm["resource"])
+		require.Equal(s.T(), []string{"downstream"}, r.PostForm["audience"])
+		require.Equal(s.T(), string(auth.TokenTypeAccessToken), r.PostForm.Get("requested_token_type"))
+		require.Equal(s.T(), "read write", r.PostForm.Get("scope"), "the client scopes should be requested by default")
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":      "exchanged",
+			"issued_token_type": auth.TokenTypeAccessToken,
+			"token_type":        "Bearer",
+			"expires_in":        300,
+		})
+	}
+
+	t, err := s.client.TokenWithTokenExchange(s.ctx, &auth.TokenExchangeRequest{
+		SubjectToken:       "subject",
+		SubjectTokenType:   auth.TokenTypeAccessToken,
+		ActorToken:         "actor",
+		ActorTokenType:     auth.TokenTypeJWT,
+		Resources:          []string{"https://api1.example.com", "https://api2.example.com"},
+		Audiences:          []string{"downstream"},
+		RequestedTokenType: auth.TokenTypeAccessToken,
+	}, nil)
+	require.NoError(s.T(), err, "unable to exchange the token")
+	require.Equal(s.T(), "exchanged", t.AccessToken)
+	require.Equal(s.T(), string(auth.TokenTypeAccessToken), t.IssuedTokenType)
+
+	_, err = s.client.TokenWithTokenExchange(s.ctx, &auth.TokenExchangeRequest{
+		SubjectToken:     "subject",
+		SubjectTokenType: auth.TokenTypeAccessToken,
+		ActorToken:       "actor",
+	}, nil)
+	require.Error(s.T(), err, "the actor token type should be required")
+}
+
+func (s *ClientTestSuite) TestJWTBearer() {
+	key := newSigningKey(s.T(), "workload")
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(s.T(), "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+		require.Equal(s.T(), "clientSecret", r.PostForm.Get("client_secret"))
+
+		token, err := jwt.ParseSigned(r.PostForm.Get("assertion"), []jose.SignatureAlgorithm{jose.RS256})
+		require.NoError(s.T(), err, "unable to parse the assertion")
+
+		claims := map[string]any{}
+		require.NoError(s.T(), token.Claims(key.Public().Key, &claims), "unable to verify the assertion")
+		require.Equal(s.T(), "clientID", claims["iss"])
+		require.Equal(s.T(), "workload", claims["sub"])
+		require.Equal(s.T(), "prod", claims["env"])
+		require.Contains(s.T(), claims["aud"], s.server.URL+"/oauth2/token")
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   7200,
+		})
+	}
+
+	t, err := s.client.TokenWithJWTBearer(s.ctx, &auth.JWTBearerAssertion{
+		SigningKey: &key,
+		Subject:    "workload",
+		Claims:     map[string]any{"env": "prod", "sub": "ignored"},
+	}, nil)
+	require.NoError(s.T(), err, "unable to get a token using the JWT bearer grant")
+	require.Equal(s.T(), "access", t.AccessToken)
+
+	_, err = s.client.TokenWithJWTBearer(s.ctx, &auth.JWTBearerAssertion{SigningKey: &key}, nil)
+	require.Error(s.T(), err, "the subject should be required")
+}
+
+func (s *ClientTestSuite) TestBackchannelFlow() {
+	polls := 0
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/backchannel_authentication":
+			require.Equal(s.T(), "customer@example.com", r.PostForm.Get("login_hint"))
+			require.Equal(s.T(), "Call 1234", r.PostForm.Get("binding_message"))
+			writeJSON(w, http.StatusOK, map[string]any{
+				"auth_req_id": "reqID",
+				"expires_in":  60,
+				"interval":    1,
+			})
+		case "/oauth2/token":
+			require.Equal(s.T(), "urn:openid:params:grant-type:ciba", r.PostForm.Get("grant_type"))
+			require.Equal(s.T(), "reqID", r.PostForm.Get("auth_req_id"))
+			polls++
+			if polls == 1 {
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "authorization_pending"})
+				return
+			}
+
+			writeJSON(w, http.StatusOK, map[string]any{
+				"access_token": "access",
+				"token_type":   "Bearer",
+				"expires_in":   7200,
+			})
+		}
+	}
+
+	authResponse, err := s.client.AuthorizeWithBackchannelFlow(s.ctx, &auth.BackchannelAuthRequest{
+		LoginHint:      "customer@example.com",
+		BindingMessage: "Call 1234",
+	}, nil)
+	require.NoError(s.T(), err, "unable to start the backchannel flow")
+	require.Equal(s.T(), "reqID", authResponse.AuthReqID)
+
+	_, err = s.client.TokenWithAuthReqID(s.ctx, authResponse.AuthReqID)
+	require.ErrorIs(s.T(), err, auth.ErrAuthorizationPending)
+
+	t, err := s.client.TokenWithBackchannelFlow(s.ctx, authResponse)
+	require.NoError(s.T(), err, "unable to get the token")
+	require.Equal(s.T(), "access", t.AccessToken)
+}
+
+func (s *ClientTestSuite) TestPassword() {
+	s.client.Scopes = []string{"openid", "profile"}
+	var errorResponse map[string]any
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(s.T(), "password", r.PostForm.Get("grant_type"))
+		require.Equal(s.T(), "user@example.com", r.PostForm.Get("username"))
+		require.Equal(s.T(), "secret", r.PostForm.Get("password"))
+		require.Equal(s.T(), "clientSecret", r.PostForm.Get("client_secret"))
+		require.Equal(s.T(), "openid profile", r.PostForm.Get("scope"))
+		if errorResponse != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   7200,
+			"scope":        "openid profile",
+		})
+	}
+
+	t, err := s.client.TokenWithPassword(s.ctx, "user@example.com", "secret", nil)
+	require.NoError(s.T(), err, "unable to get a token using the password grant")
+	require.Equal(s.T(), "access", t.AccessToken)
+	require.Equal(s.T(), "openid profile", t.Scope)
+
+	for _, tc := range []struct {
+		response map[string]any
+		expected error
+	}{
+		{map[string]any{"error": "invalid_grant", "error_description": "The user account is locked."}, auth.ErrAccountLocked},
+		{map[string]any{"error": "invalid_grant", "error_description": "The password has expired."}, auth.ErrPasswordExpired},
+		{map[string]any{"error": "invalid_grant", "error_description": "Multi-factor authentication is required."}, auth.ErrMFARequired},
+		{map[string]any{"error": "interaction_required"}, auth.ErrMFARequired},
+		{map[string]any{"error": "too_many_attempts", "error_description": "The user is blocked."}, auth.ErrAccountLocked},
+		{map[string]any{"error": "mfa_required"}, auth.ErrMFARequired},
+		{map[string]any{"error": "invalid_grant", "error_description": "Invalid credentials."}, auth.ErrInvalidGrant},
+	} {
+		errorResponse = tc.response
+		_, err = s.client.TokenWithPassword(s.ctx, "user@example.com", "secret", nil)
+		require.ErrorIs(s.T(), err, tc.expected, "unexpected error for %v", tc.response)
+
+		var oauthErr *auth.OAuthError
+		require.True(s.T(), errors.As(err, &oauthErr))
+		require.Equal(s.T(), tc.response["error"], oauthErr.Code)
+	}
+
+	require.ErrorIs(s.T(), err, auth.ErrInvalidGrant)
+	require.NotErrorIs(s.T(), err, auth.ErrAccountLocked)
+
+	// only the description of invalid_grant errors identifies the reason
+	errorResponse = map[string]any{"error": "invalid_client", "error_description": "The client is disabled."}
+	_, err = s.client.TokenWithPassword(s.ctx, "user@example.com", "secret", nil)
+	require.ErrorIs(s.T(), err, auth.ErrInvalidClient)
+	require.NotErrorIs(s.T(), err, auth.ErrAccountLocked, "a disabled client is not a locked account")
+
+	_, err = s.client.TokenWithPassword(s.ctx, "user@example.com", "", nil)
+	require.Error(s.T(), err, "the password should be required")
+}
+
+func (s *ClientTestSuite) TestDeviceLogin() {
+	var tokenResponses []map[string]any
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/device_authorization":
+			writeJSON(w, http.StatusOK, map[string]any{
+				"device_code":               "deviceCode",
+				"user_code":                 "ABCD-EFGH",
+				"verification_uri":          "https://tenant.example.com/device",
+				"verification_uri_complete": "https://tenant.example.com/device?user_code=ABCD-EFGH",
+				"expires_in":                60,
+				"interval":                  1,
+			})
+		case "/oauth2/token":
+			require.Equal(s.T(), "urn:ietf:params:oauth:grant-type:device_code", r.PostForm.Get("grant_type"))
+			require.Equal(s.T(), "deviceCode", r.PostForm.Get("device_code"))
+			res := tokenResponses[0]
+			tokenResponses = tokenResponses[1:]
+			if _, ok := res["error"]; ok {
+				writeJSON(w, http.StatusBadRequest, res)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, res)
+		}
+	}
+
+	output := &strings.Builder{}
+	var statuses []*auth.DeviceLoginStatus
+	login := auth.NewDeviceLogin(s.client, output)
+	login.OnStatus = func(status *auth.DeviceLoginStatus) {
+		statuses = append(statuses, status)
+	}
+
+	tokenResponses = []map[string]any{
+		{"error": "authorization_pending"},
+		{"access_token": "access", "token_type": "Bearer", "expires_in": 7200},
+	}
+	t, err := login.Login(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to complete the device login")
+	require.Equal(s.T(), "access", t.AccessToken)
+	require.Contains(s.T(), output.String(), "ABCD-EFGH")
+	require.Contains(s.T(), output.String(), "https://tenant.example.com/device?user_code=ABCD-EFGH")
+	require.Contains(s.T(), output.String(), "█", "the QR code should be rendered")
+	require.Len(s.T(), statuses, 1)
+	require.Equal(s.T(), 1, statuses[0].Attempts)
+	require.Greater(s.T(), statuses[0].ExpiresIn, 50*time.Second)
+
+	// slow_down increases the interval
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	login.OnStatus = func(status *auth.DeviceLoginStatus) {
+		require.True(s.T(), status.SlowDown)
+		require.Equal(s.T(), 6*time.Second, status.Interval)
+		cancel()
+	}
+
+	tokenResponses = []map[string]any{{"error": "slow_down"}}
+	_, err = login.Login(ctx, nil)
+	require.ErrorIs(s.T(), err, context.Canceled)
+
+	login.Output = nil
+	login.OnStatus = nil
+	tokenResponses = []map[string]any{{"error": "access_denied"}}
+	_, err = login.Login(s.ctx, nil)
+	require.ErrorIs(s.T(), err, auth.ErrAccessDenied)
+}
+
+func (s *ClientTestSuite) TestBackchannelNotification() {
+	newRequest := func(token string, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/cb", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	n, err := auth.ParseBackchannelNotification(newRequest("notify", `{"auth_req_id":"reqID","access_token":"access","token_type":"Bearer","expires_in":60}`), "notify")
+	require.NoError(s.T(), err, "unable to parse the push notification")
+	require.Equal(s.T(), "reqID", n.AuthReqID)
+	require.Equal(s.T(), "access", n.TokenResponse.AccessToken)
+
+	n, err = auth.ParseBackchannelNotification(newRequest("notify", `{"auth_req_id":"reqID","error":"access_denied"}`), "notify")
+	require.NoError(s.T(), err, "unable to parse the error notification")
+	require.ErrorIs(s.T(), n.Error, auth.ErrAccessDenied)
+
+	_, err = auth.ParseBackchannelNotification(newRequest("other", `{"auth_req_id":"reqID"}`), "notify")
+	require.Error(s.T(), err, "the notification token should be validated")
+}
+
+func (s *ClientTestSuite) TestLoopbackRedirect() {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.True(s.T(), strings.HasPrefix(r.PostForm.Get("redirect_uri"), "http://127.0.0.1:"))
+		require.NotEmpty(s.T(), r.PostForm.Get("code_verifier"))
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   7200,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	pages := make(chan int, 2)
+	openURL := func(authCodeURL string) error {
+		u, err := url.Parse(authCodeURL)
+		require.NoError(s.T(), err, "unable to parse the authorization URL")
+		q := u.Query()
+
+		// simulate the browser being redirected back by the authorization server
+		go func() {
+			res, err := http.Get(q.Get("redirect_uri") + "?code=abc&state=other")
+			require.NoError(s.T(), err, "unable to call the callback")
+			res.Body.Close()
+			pages <- res.StatusCode
+
+			res, err = http.Get(q.Get("redirect_uri") + "?code=abc&state=" + q.Get("state"))
+			require.NoError(s.T(), err, "unable to call the callback")
+			res.Body.Close()
+			pages <- res.StatusCode
+		}()
+
+		return nil
+	}
+
+	t, err := s.client.TokenWithLoopbackRedirect(ctx, &auth.LoopbackOptions{OpenURL: openURL}, nil)
+	require.NoError(s.T(), err, "unable to complete the loopback flow")
+	require.Equal(s.T(), "access", t.AccessToken)
+	require.Equal(s.T(), http.StatusBadRequest, <-pages, "a mismatched state should be rejected")
+	require.Equal(s.T(), http.StatusOK, <-pages)
+	require.Empty(s.T(), s.client.RedirectURL, "the client should not be modified")
+}
+
+func (s *ClientTestSuite) TestLoopbackRedirectFailure() {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":             "invalid_grant",
+			"error_description": "<expired>",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	pages := make(chan string, 1)
+	openURL := func(authCodeURL string) error {
+		u, err := url.Parse(authCodeURL)
+		require.NoError(s.T(), err, "unable to parse the authorization URL")
+		q := u.Query()
+
+		go func() {
+			res, err := http.Get(q.Get("redirect_uri") + "?code=abc&state=" + q.Get("state"))
+			require.NoError(s.T(), err, "unable to call the callback")
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			pages <- string(body)
+		}()
+
+		return nil
+	}
+
+	_, err := s.client.TokenWithLoopbackRedirect(ctx, &auth.LoopbackOptions{
+		OpenURL:     openURL,
+		FailurePage: `<p style="width: 100%">Failed: %s</p>`,
+	}, nil)
+	require.ErrorIs(s.T(), err, auth.ErrInvalidGrant)
+
+	page := <-pages
+	require.True(s.T(), strings.HasPrefix(page, `<p style="width: 100%">Failed: `), "only %%s should be replaced; page=%s", page)
+	require.Contains(s.T(), page, "&lt;expired&gt;", "the error should be escaped")
+}
+
+func (s *ClientTestSuite) TestClientRegistration() {
+	registered := map[string]any{}
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/oauth2/register":
+			require.Equal(s.T(), "Bearer initial", r.Header.Get("Authorization"))
+			require.NoError(s.T(), json.NewDecoder(r.Body).Decode(&registered), "unable to parse the metadata")
+			require.Equal(s.T(), "ephemeral", registered["client_name"])
+			require.Equal(s.T(), "tenant-specific", registered["x_custom"])
+
+			resp := map[string]any{
+				"client_id":                 "newClient",
+				"client_secret":             "newSecret",
+				"registration_access_token": "rat",
+				"registration_client_uri":   s.server.URL + "/oauth2/register/newClient",
+			}
+			for k, v := range registered {
+				resp[k] = v
+			}
+			writeJSON(w, http.StatusCreated, resp)
+		case r.URL.Path == "/oauth2/register/newClient":
+			require.Equal(s.T(), "Bearer rat", r.Header.Get("Authorization"))
+			switch r.Method {
+			case http.MethodPut:
+				body := map[string]any{}
+				require.NoError(s.T(), json.NewDecoder(r.Body).Decode(&body), "unable to parse the metadata")
+				require.Equal(s.T(), "newClient", body["client_id"])
+				writeJSON(w, http.StatusOK, body)
+			case http.MethodGet:
+				// the registration access token and client URI may be omitted once issued
+				writeJSON(w, http.StatusOK, map[string]any{"client_id": "newClient", "client_name": "renamed"})
+			case http.MethodDelete:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		case r.URL.Path == "/oauth2/token":
+			clientID, clientSecret, _ := r.BasicAuth()
+			require.Equal(s.T(), "newClient", clientID)
+			require.Equal(s.T(), "newSecret", clientSecret)
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": "access", "token_type": "Bearer"})
+		}
+	}
+
+	registration, err := s.client.RegisterClient(s.ctx, &auth.ClientMetadata{
+		ClientName:              "ephemeral",
+		GrantTypes:              []string{"client_credentials"},
+		TokenEndpointAuthMethod: auth.ClientAuthMethodClientSecretBasic,
+		Extra:                   map[string]any{"x_custom": "tenant-specific"},
+	}, "initial")
+	require.NoError(s.T(), err, "unable to register the client")
+	require.Equal(s.T(), "newClient", registration.ClientID)
+	require.Equal(s.T(), "tenant-specific", registration.Extra["x_custom"])
+
+	client, err := registration.NewClient(s.client)
+	require.NoError(s.T(), err, "unable to create the client")
+	_, err = client.TokenWithAPIClient(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to get a token for the registered client")
+
+	updated, err := s.client.UpdateClientRegistration(s.ctx, registration, &auth.ClientMetadata{ClientName: "renamed"})
+	require.NoError(s.T(), err, "unable to update the client")
+	require.Equal(s.T(), "renamed", updated.ClientName)
+	require.Equal(s.T(), "rat", updated.RegistrationAccessToken, "the registration access token should be kept")
+	require.Equal(s.T(), registration.RegistrationClientURI, updated.RegistrationClientURI, "the registration client URI should be kept")
+
+	current, err := s.client.ReadClientRegistration(s.ctx, updated)
+	require.NoError(s.T(), err, "unable to read the client")
+	require.Equal(s.T(), "renamed", current.ClientName)
+	require.Equal(s.T(), "rat", current.RegistrationAccessToken, "the registration access token should be kept")
+
+	require.NoError(s.T(), s.client.DeleteClientRegistration(s.ctx, current), "unable to delete the client")
+
+	registration.TokenEndpointAuthMethod = auth.ClientAuthMethodPrivateKeyJWT
+	_, err = registration.NewClient(s.client)
+	require.Error(s.T(), err, "the signing key should be required from the base client")
+}
+
+func (s *ClientTestSuite) TestAuthorizationDetails() {
+	details := []auth.AuthorizationDetail{{
+		Type:      "payment_initiation",
+		Locations: []string{"https://payments.example.com"},
+		Actions:   []string{"initiate"},
+		Extra: map[string]any{
+			"instructedAmount": map[string]any{"currency": "EUR", "amount": "123.50"},
+		},
+	}}
+
+	params := url.Values{}
+	require.NoError(s.T(), auth.SetAuthorizationDetails(params, details), "unable to set the authorization details")
+
+	authResponse, err := s.client.AuthorizeWithBrowserFlow(s.ctx, params)
+	require.NoError(s.T(), err, "unable to build the authorization URL")
+	u, err := url.Parse(authResponse.AuthCodeURL)
+	require.NoError(s.T(), err, "invalid authorization URL")
+	require.JSONEq(s.T(), `[{"type":"payment_initiation","locations":["https://payments.example.com"],"actions":["initiate"],"instructedAmount":{"currency":"EUR","amount":"123.50"}}]`, u.Query().Get("authorization_details"))
+
+	// request objects contain the details as a JSON array
+	signingKey := newSigningKey(s.T(), "jar")
+	s.client.RequestObject = &auth.RequestObjectOptions{SigningKey: &signingKey}
+	authResponse, err = s.client.AuthorizeWithBrowserFlow(s.ctx, params)
+	require.NoError(s.T(), err, "unable to build the authorization URL")
+	u, err = url.Parse(authResponse.AuthCodeURL)
+	require.NoError(s.T(), err, "invalid authorization URL")
+
+	token, err := jwt.ParseSigned(u.Query().Get("request"), []jose.SignatureAlgorithm{jose.RS256})
+	require.NoError(s.T(), err, "unable to parse the request object")
+	claims := map[string]any{}
+	require.NoError(s.T(), token.Claims(signingKey.Public(), &claims), "unable to verify the request object")
+	require.Equal(s.T(), "payment_initiation", claims["authorization_details"].([]any)[0].(map[string]any)["type"])
+
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		require.JSONEq(s.T(), params.Get("authorization_details"), r.PostForm.Get("authorization_details"))
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":          "access",
+			"token_type":            "Bearer",
+			"authorization_details": []any{map[string]any{"type": "payment_initiation", "identifier": "payment-1"}},
+		})
+	}
+
+	t, err := s.client.TokenWithRefreshToken(s.ctx, "refresh", params)
+	require.NoError(s.T(), err, "unable to refresh the token")
+	require.Equal(s.T(), "payment-1", t.AuthorizationDetails[0].Identifier)
+
+	t, err = s.client.TokenWithAPIClient(s.ctx, params)
+	require.NoError(s.T(), err, "unable to get a token")
+	require.Equal(s.T(), "payment_initiation", t.AuthorizationDetails[0].Type)
+
+	require.Error(s.T(), auth.SetAuthorizationDetails(url.Values{}, []auth.AuthorizationDetail{{}}), "the type should be required")
+}
+
+func TestClientTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientTestSuite))
+}
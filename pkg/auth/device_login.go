@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	"github.com/ibm-verify/verify-sdk-go/x/qrx"
+)
+
+const (
+	// DefaultDevicePollInterval is the interval between token requests when the device
+	// authorization response does not specify one.
+	DefaultDevicePollInterval = 5 * time.Second
+
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// DeviceLoginStatus describes the progress of a DeviceLogin while the user has not yet
+// completed the flow on another device.
+type DeviceLoginStatus struct {
+	// Attempts is the number of token requests made so far.
+	Attempts int
+
+	// Interval is the time until the next token request.
+	Interval time.Duration
+
+	// ExpiresIn is the time left before the device code expires, or 0 if it is not known.
+	ExpiresIn time.Duration
+
+	// SlowDown is true when the authorization server asked the client to poll less often,
+	// which increases the Interval.
+	SlowDown bool
+}
+
+// DeviceLogin runs the device authorization grant flow for applications without a browser,
+// such as CLIs. It shows the user code and verification URI, optionally as a QR code that
+// can be scanned with a phone, and polls for the token until the user completes the flow.
+type DeviceLogin struct {
+	// Client is used to start the flow and request the token.
+	Client *Client
+
+	// Output receives the instructions for the user, such as os.Stderr. If nil, nothing is
+	// written, which is useful when OnPrompt shows the instructions instead.
+	Output io.Writer
+
+	// DisableQRCode prevents the verification URI from being written as a QR code.
+	DisableQRCode bool
+
+	// InvertQRCode draws the QR code for terminals with a light background.
+	InvertQRCode bool
+
+	// OnPrompt is optionally called with the device authorization response before polling starts.
+	OnPrompt func(authResponse *DeviceAuthResponse)
+
+	// OnStatus is optionally called each time the authorization server responds that the
+	// flow is not yet complete.
+	OnStatus func(status *DeviceLoginStatus)
+}
+
+// NewDeviceLogin returns a DeviceLogin that writes the instructions, including a QR code,
+// to the output.
+func NewDeviceLogin(client *Client, output io.Writer) *DeviceLogin {
+	return &DeviceLogin{
+		Client: client,
+		Output: output,
+	}
+}
+
+// Login starts the device authorization grant flow, shows the instructions and waits for the
+// user to complete the flow. The parameters are sent in the device authorization request.
+//
+// If the device code expires, the error matches ErrExpiredToken using errors.Is. If the user
+// denies the request, the error matches ErrAccessDenied.
+func (d *DeviceLogin) Login(ctx context.Context, parameters url.Values) (*TokenResponse, error) {
+	if d.Client == nil {
+		return nil, errorsx.G11NError("'Client' is required.")
+	}
+
+	authResponse, err := d.Client.AuthorizeWithDeviceFlow(ctx, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Output != nil {
+		if err := d.writePrompt(authResponse); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.OnPrompt != nil {
+		d.OnPrompt(authResponse)
+	}
+
+	interval := time.Duration(authResponse.Interval) * time.Second
+	if interval == 0 {
+		interval = DefaultDevicePollInterval
+	}
+
+	for attempts := 1; ; attempts++ {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		t, err := d.Client.tokenRequest(ctx, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {authResponse.DeviceCode},
+		})
+
+		slowDown := errors.Is(err, ErrSlowDown)
+		switch {
+		case err == nil:
+			return t, nil
+		case slowDown:
+			interval += 5 * time.Second
+		case !errors.Is(err, ErrAuthorizationPending):
+			return nil, err
+		}
+
+		var expiresIn time.Duration
+		if !authResponse.Expiry.IsZero() {
+			if expiresIn = time.Until(authResponse.Expiry); expiresIn <= 0 {
+				return nil, ErrExpiredToken
+			}
+		}
+
+		if d.OnStatus != nil {
+			d.OnStatus(&DeviceLoginStatus{
+				Attempts:  attempts,
+				Interval:  interval,
+				ExpiresIn: expiresIn,
+				SlowDown:  slowDown,
+			})
+		}
+	}
+}
+
+// writePrompt writes the instructions for the user to the output.
+func (d *DeviceLogin) writePrompt(authResponse *DeviceAuthResponse) error {
+	sb := &strings.Builder{}
+	if authResponse.VerificationURIComplete != "" {
+		fmt.Fprintf(sb, "To sign in, open the following URL in a browser and confirm the code %s:\n\n  %s\n\n",
+			authResponse.UserCode, authResponse.VerificationURIComplete)
+	} else {
+		fmt.Fprintf(sb, "To sign in, open the following URL in a browser and enter the code %s:\n\n  %s\n\n",
+			authResponse.UserCode, authResponse.VerificationURI)
+	}
+
+	if !d.DisableQRCode {
+		verificationURI := authResponse.VerificationURIComplete
+		if verificationURI == "" {
+			verificationURI = authResponse.VerificationURI
+		}
+
+		// a URI that is too long for a QR code is still shown as text
+		if code, err := qrx.Encode(verificationURI); err == nil {
+			fmt.Fprintf(sb, "Or scan the QR code using your phone:\n\n%s\n", code.Terminal(d.InvertQRCode))
+		}
+	}
+
+	if _, err := io.WriteString(d.Output, sb.String()); err != nil {
+		return errorsx.G11NError("unable to write the instructions; err=%v", err)
+	}
+
+	return nil
+}
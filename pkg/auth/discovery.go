@@ -1,9 +1,159 @@
 package auth
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
 const (
 	DiscoveryEndpoint = "/.well-known/openid-configuration"
+
+	// DefaultDiscoveryTTL is how long a fetched discovery document is cached by default.
+	DefaultDiscoveryTTL = 1 * time.Hour
+
+	// DefaultDiscoveryMinRefreshInterval is the minimum interval between fetches following
+	// a failed fetch.
+	DefaultDiscoveryMinRefreshInterval = 1 * time.Minute
 )
 
+// Discovery fetches the OpenID Connect discovery document of the tenant and caches it.
+// After a failed fetch, the document is not fetched again until MinRefreshInterval has
+// passed. In the meantime, the previously fetched document is returned, even once it is
+// older than the TTL, or the error if none was fetched. It is safe for concurrent use.
+type Discovery struct {
+	// Tenant is the IBM Verify hostname that is used to identify the tenant.
+	// Custom domains may also be used if configured for the tenant.
+	Tenant string
+
+	// Issuer optionally overrides the issuer URL that is used to locate the discovery
+	// document. By default, this is set to https://<Tenant>/oauth2. The issuer in
+	// the fetched document is expected to match this value.
+	Issuer string
+
+	// TTL specifies how long the fetched document is cached. By default, this is
+	// set to DefaultDiscoveryTTL.
+	TTL time.Duration
+
+	// MinRefreshInterval limits how often the document is fetched again after a failed
+	// fetch. By default, this is set to DefaultDiscoveryMinRefreshInterval.
+	MinRefreshInterval time.Duration
+
+	mu        sync.Mutex
+	config    *OpenIDConfiguration
+	fetchedAt time.Time
+	failedAt  time.Time
+	fetchErr  error
+}
+
+// NewDiscovery returns a Discovery for the tenant.
+func NewDiscovery(tenant string) *Discovery {
+	return &Discovery{
+		Tenant: tenant,
+	}
+}
+
+// Configuration returns the cached discovery document, fetching it if it has not been
+// fetched yet or if the cached document is older than the TTL. If fetching it again fails,
+// the cached document is returned.
+func (d *Discovery) Configuration(ctx context.Context) (*OpenIDConfiguration, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ttl := d.TTL
+	if ttl == 0 {
+		ttl = DefaultDiscoveryTTL
+	}
+
+	minRefresh := d.MinRefreshInterval
+	if minRefresh == 0 {
+		minRefresh = DefaultDiscoveryMinRefreshInterval
+	}
+
+	if d.config != nil && time.Since(d.fetchedAt) < ttl {
+		return d.config, nil
+	}
+
+	if d.fetchErr != nil && time.Since(d.failedAt) < minRefresh {
+		if d.config != nil {
+			return d.config, nil
+		}
+
+		return nil, d.fetchErr
+	}
+
+	config, err := d.fetch(ctx)
+	if err != nil {
+		// a cancelled request says nothing about the availability of the document
+		if ctx.Err() == nil {
+			d.fetchErr = err
+			d.failedAt = time.Now()
+		}
+
+		if d.config != nil {
+			return d.config, nil
+		}
+
+		return nil, err
+	}
+
+	d.config = config
+	d.fetchedAt = time.Now()
+	d.fetchErr = nil
+	return config, nil
+}
+
+func (d *Discovery) issuer() string {
+	if d.Issuer != "" {
+		return strings.TrimSuffix(d.Issuer, "/")
+	}
+
+	return fmt.Sprintf("https://%s/oauth2", d.Tenant)
+}
+
+func (d *Discovery) fetch(ctx context.Context) (*OpenIDConfiguration, error) {
+	issuer := d.issuer()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+DiscoveryEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	res, err := contextHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, errorsx.G11NError("unable to fetch the discovery document; err=%v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, errorsx.G11NError("unable to read the discovery document; err=%v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errorsx.G11NError("unable to fetch the discovery document; status=%d, body=%s", res.StatusCode, string(body))
+	}
+
+	config := &OpenIDConfiguration{}
+	if err := json.Unmarshal(body, config); err != nil {
+		return nil, errorsx.G11NError("unable to parse the discovery document; err=%v", err)
+	}
+
+	if strings.TrimSuffix(config.Issuer, "/") != issuer {
+		return nil, errorsx.G11NError("the discovery document issuer '%s' does not match '%s'", config.Issuer, issuer)
+	}
+
+	return config, nil
+}
+
 type OpenIDConfiguration struct {
 	// Issuer is the identifier of the OP and is used in the tokens as `iss` claim.
 	Issuer string `json:"issuer,omitempty"`
@@ -38,6 +188,18 @@ type OpenIDConfiguration struct {
 
 	MTLSEndpointAliases *MTLSEndpointAliases `json:"mtls_endpoint_aliases,omitempty"`
 
+	// AuthorizationDetailsTypesSupported contains a list of the authorization details types supported in the authorization_details parameter.
+	AuthorizationDetailsTypesSupported []string `json:"authorization_details_types_supported,omitempty"`
+
+	// BackchannelAuthenticationEndpoint is the URL of the Client-Initiated Backchannel Authentication (CIBA) Endpoint.
+	BackchannelAuthenticationEndpoint string `json:"backchannel_authentication_endpoint,omitempty"`
+
+	// BackchannelTokenDeliveryModesSupported contains a list of the CIBA token delivery modes supported (poll, ping, push).
+	BackchannelTokenDeliveryModesSupported []string `json:"backchannel_token_delivery_modes_supported,omitempty"`
+
+	// BackchannelUserCodeParameterSupported specifies whether the user_code parameter is supported in CIBA requests.
+	BackchannelUserCodeParameterSupported bool `json:"backchannel_user_code_parameter_supported,omitempty"`
+
 	// RegistrationEndpoint is the URL for the Dynamic Client Registration.
 	RegistrationEndpoint string `json:"registration_endpoint,omitempty"`
 
@@ -169,5 +331,90 @@ type MTLSEndpointAliases struct {
 	// RevocationEndpoint is the URL of the OAuth 2.0 Revocation Endpoint.
 	RevocationEndpoint string `json:"revocation_endpoint,omitempty"`
 
+	// PushedAuthorizationRequestEndpoint is the URL of the OAuth 2.0 Pushed Authorization Request Endpoint.
 	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint,omitempty"`
 }
+
+// openIDConfigurationFields contains the JSON property names of the well known fields of OpenIDConfiguration.
+var openIDConfigurationFields = jsonFieldNames(reflect.TypeOf(OpenIDConfiguration{}))
+
+// jsonFieldNames returns the JSON property names of the fields of the struct type, including
+// the fields of embedded structs.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k := range jsonFieldNames(f.Type) {
+				fields[k] = true
+			}
+			continue
+		}
+
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+
+	return fields
+}
+
+// extraFields returns the properties of the JSON object that are not in the known fields, or
+// nil if there are none.
+func extraFields(data []byte, known map[string]bool) (map[string]any, error) {
+	all := map[string]any{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	var extra map[string]any
+	for k, v := range all {
+		if known[k] {
+			continue
+		}
+
+		if extra == nil {
+			extra = map[string]any{}
+		}
+		extra[k] = v
+	}
+
+	return extra, nil
+}
+
+// mergeExtraFields adds the extra properties to the JSON object, without replacing the
+// properties it already contains.
+func mergeExtraFields(data []byte, extra map[string]any) ([]byte, error) {
+	if len(extra) == 0 {
+		return data, nil
+	}
+
+	all := map[string]any{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	for k, v := range extra {
+		if _, ok := all[k]; !ok {
+			all[k] = v
+		}
+	}
+
+	return json.Marshal(all)
+}
+
+func (c *OpenIDConfiguration) UnmarshalJSON(data []byte) error {
+	type openIDConfiguration OpenIDConfiguration
+	if err := json.Unmarshal(data, (*openIDConfiguration)(c)); err != nil {
+		return err
+	}
+
+	extra, err := extraFields(data, openIDConfigurationFields)
+	if err != nil {
+		return err
+	}
+
+	c.Extra = extra
+	return nil
+}
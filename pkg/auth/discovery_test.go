@@ -0,0 +1,148 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type DiscoveryTestSuite struct {
+	suite.Suite
+
+	ctx       context.Context
+	server    *httptest.Server
+	tenant    string
+	fetches   atomic.Int32
+	discovery *auth.Discovery
+}
+
+func (s *DiscoveryTestSuite) SetupTest() {
+	s.fetches.Store(0)
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2" + auth.DiscoveryEndpoint:
+			s.fetches.Add(1)
+			writeJSON(w, http.StatusOK, map[string]any{
+				"issuer":         "https://" + s.tenant + "/oauth2",
+				"token_endpoint": "https://" + s.tenant + "/custom/token",
+				"jwks_uri":       "https://" + s.tenant + "/oauth2/jwks",
+				"tenant_region":  "us-south",
+			})
+		case "/custom/token":
+			writeJSON(w, http.StatusOK, map[string]any{
+				"access_token": "access",
+				"token_type":   "Bearer",
+				"expires_in":   7200,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	s.tenant = strings.TrimPrefix(s.server.URL, "https://")
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+	s.discovery = auth.NewDiscovery(s.tenant)
+}
+
+func (s *DiscoveryTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *DiscoveryTestSuite) TestConfiguration() {
+	config, err := s.discovery.Configuration(s.ctx)
+	require.NoError(s.T(), err, "unable to fetch the discovery document")
+	require.Equal(s.T(), "https://"+s.tenant+"/custom/token", config.TokenEndpoint)
+	require.Equal(s.T(), map[string]any{"tenant_region": "us-south"}, config.Extra)
+
+	_, err = s.discovery.Configuration(s.ctx)
+	require.NoError(s.T(), err, "unable to fetch the discovery document")
+	require.EqualValues(s.T(), 1, s.fetches.Load(), "the document should be cached")
+}
+
+func (s *DiscoveryTestSuite) TestClientEndpoints() {
+	client := &auth.Client{
+		Tenant: s.tenant,
+		ClientAuth: &auth.ClientSecretPost{
+			ClientID:     "clientID",
+			ClientSecret: "clientSecret",
+		},
+		Discovery: s.discovery,
+	}
+
+	t, err := client.TokenWithAPIClient(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to get a token from the discovered endpoint")
+	require.Equal(s.T(), "access", t.AccessToken)
+
+	_, err = client.IntrospectToken(s.ctx, "access", "")
+	require.Error(s.T(), err, "introspection is not advertised")
+}
+
+func (s *DiscoveryTestSuite) TestIssuerMismatch() {
+	s.discovery.Issuer = "https://" + s.tenant + "/oauth2/"
+	_, err := s.discovery.Configuration(s.ctx)
+	require.NoError(s.T(), err, "trailing slashes should be ignored")
+
+	d := auth.NewDiscovery(s.tenant)
+	d.Issuer = "https://" + s.tenant + "/oauth2"
+	s.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"issuer": "https://attacker.example.com/oauth2"})
+	})
+	_, err = d.Configuration(s.ctx)
+	require.Error(s.T(), err, "the issuer should be validated")
+}
+
+func (s *DiscoveryTestSuite) TestFetchFailure() {
+	handler := s.server.Config.Handler
+	var failures atomic.Int32
+	s.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := s.discovery.Configuration(s.ctx)
+		require.Error(s.T(), err, "the document is unavailable")
+	}
+	require.EqualValues(s.T(), 1, failures.Load(), "a failed fetch should not be retried before the minimum refresh interval")
+
+	s.server.Config.Handler = handler
+	_, err := s.discovery.Configuration(s.ctx)
+	require.Error(s.T(), err, "the failure should be returned until the minimum refresh interval has passed")
+
+	s.discovery.MinRefreshInterval = time.Nanosecond
+	_, err = s.discovery.Configuration(s.ctx)
+	require.NoError(s.T(), err, "the document should be fetched again after the minimum refresh interval")
+	require.EqualValues(s.T(), 1, s.fetches.Load())
+}
+
+func (s *DiscoveryTestSuite) TestStaleConfiguration() {
+	s.discovery.TTL = time.Nanosecond
+	_, err := s.discovery.Configuration(s.ctx)
+	require.NoError(s.T(), err, "unable to fetch the discovery document")
+
+	var failures atomic.Int32
+	s.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	for i := 0; i < 3; i++ {
+		config, err := s.discovery.Configuration(s.ctx)
+		require.NoError(s.T(), err, "the cached document should be returned when it cannot be fetched again")
+		require.Equal(s.T(), "https://"+s.tenant+"/custom/token", config.TokenEndpoint)
+	}
+	require.EqualValues(s.T(), 1, failures.Load(), "a failed fetch should not be retried before the minimum refresh interval")
+}
+
+func TestDiscoveryTestSuite(t *testing.T) {
+	suite.Run(t, new(DiscoveryTestSuite))
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/google/uuid"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+const (
+	// DPoPProofType is the typ header of DPoP proofs, as described in RFC 9449.
+	DPoPProofType = "dpop+jwt"
+)
+
+// DPoPKey holds the key pair used to bind tokens to the client using Demonstrating
+// Proof of Possession (DPoP), as described in RFC 9449, and generates the per-request
+// proofs. Nonces provided by servers in the DPoP-Nonce header are remembered per origin
+// and included in subsequent proofs. It is safe for concurrent use.
+type DPoPKey struct {
+	key *jose.JSONWebKey
+
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+// NewDPoPKey generates a new P-256 key pair that signs proofs using ES256.
+func NewDPoPKey() (*DPoPKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDPoPKeyWithJWK(&jose.JSONWebKey{
+		Key:       key,
+		Algorithm: string(jose.ES256),
+		Use:       "sig",
+	})
+}
+
+// NewDPoPKeyWithJWK returns a DPoPKey for an existing asymmetric private key. The Algorithm
+// is expected to be populated.
+func NewDPoPKeyWithJWK(key *jose.JSONWebKey) (*DPoPKey, error) {
+	if key == nil || key.IsPublic() || !key.Valid() {
+		return nil, errorsx.G11NError("a valid asymmetric private key is required")
+	}
+
+	if key.Algorithm == "" {
+		return nil, errorsx.G11NError("the key 'Algorithm' is required")
+	}
+
+	return &DPoPKey{
+		key:    key,
+		nonces: map[string]string{},
+	}, nil
+}
+
+// Thumbprint returns the base64url encoded SHA-256 JWK thumbprint of the public key, which
+// is the jkt value that DPoP-bound tokens are bound to.
+func (k *DPoPKey) Thumbprint() (string, error) {
+	public := k.key.Public()
+	thumbprint, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// Proof generates a DPoP proof for a request with the method to the URI. If the access token
+// is not empty, the proof is bound to it using the ath claim.
+func (k *DPoPKey) Proof(method string, uri string, accessToken string) (string, error) {
+	htu, origin, err := dpopTarget(uri)
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]any{
+		"jti": uuid.NewString(),
+		"htm": method,
+		"htu": htu,
+		"iat": time.Now().UTC().Unix(),
+	}
+
+	if accessToken != "" {
+		ath := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(ath[:])
+	}
+
+	k.mu.Lock()
+	nonce := k.nonces[origin]
+	k.mu.Unlock()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(k.key.Algorithm),
+		Key:       k.key,
+	}, (&jose.SignerOptions{EmbedJWK: true}).WithType(DPoPProofType))
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errorsx.G11NError("marshaling claims failed; err= %v", err)
+	}
+
+	o, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return o.CompactSerialize()
+}
+
+// HTTPClient returns an http.Client based on the provided client that adds DPoP proofs to
+// requests that do not already have one, remembers server provided nonces and retries the
+// request once when the server requires a new nonce.
+func (k *DPoPKey) HTTPClient(base *http.Client) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	c := *base
+	c.Transport = &dpopTransport{
+		key:  k,
+		base: base.Transport,
+	}
+
+	return &c
+}
+
+// updateNonce records the nonce returned by the server and reports whether it changed.
+func (k *DPoPKey) updateNonce(uri string, nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+
+	_, origin, err := dpopTarget(uri)
+	if err != nil {
+		return false
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	changed := k.nonces[origin] != nonce
+	k.nonces[origin] = nonce
+	return changed
+}
+
+// dpopTarget returns the htu value, which is the URI without the query and fragment, and the origin.
+func dpopTarget(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", errorsx.G11NError("invalid URI; err=%v", err)
+	}
+
+	origin := u.Scheme + "://" + u.Host
+	return origin + u.EscapedPath(), origin, nil
+}
+
+type dpopTransport struct {
+	key  *DPoPKey
+	base http.RoundTripper
+}
+
+func (t *dpopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	accessToken := ""
+	if scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "DPoP") {
+		accessToken = token
+	}
+
+	r, err := t.withProof(req, accessToken, req.Header.Get("DPoP") == "")
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := res.Header.Get("DPoP-Nonce")
+	if !t.key.updateNonce(req.URL.String(), nonce) || !requiresDPoPNonce(res) || (req.Body != nil && req.GetBody == nil) {
+		return res, nil
+	}
+
+	// the server requires the new nonce, so the request is sent again with a new proof
+	res.Body.Close()
+	if r, err = t.withProof(req, accessToken, true); err != nil {
+		return nil, err
+	}
+
+	if req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err = base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	t.key.updateNonce(req.URL.String(), res.Header.Get("DPoP-Nonce"))
+	return res, nil
+}
+
+func (t *dpopTransport) withProof(req *http.Request, accessToken string, generate bool) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if !generate {
+		return r, nil
+	}
+
+	proof, err := t.key.Proof(req.Method, req.URL.String(), accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("DPoP", proof)
+	return r, nil
+}
+
+// requiresDPoPNonce reports whether the response is the use_dpop_nonce error, either from the
+// token endpoint or a resource server. The response body is preserved.
+func requiresDPoPNonce(res *http.Response) bool {
+	if res.StatusCode == http.StatusUnauthorized {
+		return strings.Contains(res.Header.Get("WWW-Authenticate"), "use_dpop_nonce")
+	}
+
+	if res.StatusCode != http.StatusBadRequest {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	oauthErr := &OAuthError{}
+	return json.Unmarshal(body, oauthErr) == nil && oauthErr.Code == "use_dpop_nonce"
+}
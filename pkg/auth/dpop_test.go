@@ -0,0 +1,96 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type DPoPTestSuite struct {
+	suite.Suite
+
+	ctx    context.Context
+	server *httptest.Server
+	client *auth.Client
+	proofs []map[string]any
+}
+
+func (s *DPoPTestSuite) SetupTest() {
+	s.proofs = nil
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proof, err := jwt.ParseSigned(r.Header.Get("DPoP"), []jose.SignatureAlgorithm{jose.ES256})
+		require.NoError(s.T(), err, "the request must contain a DPoP proof")
+		require.Equal(s.T(), auth.DPoPProofType, proof.Headers[0].ExtraHeaders[jose.HeaderType])
+
+		claims := map[string]any{}
+		require.NoError(s.T(), proof.Claims(proof.Headers[0].JSONWebKey, &claims), "unable to verify the proof")
+		s.proofs = append(s.proofs, claims)
+
+		w.Header().Set("DPoP-Nonce", "server-nonce")
+		if claims["nonce"] != "server-nonce" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "use_dpop_nonce"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access",
+			"token_type":   "DPoP",
+			"expires_in":   7200,
+		})
+	}))
+
+	dpopKey, err := auth.NewDPoPKey()
+	require.NoError(s.T(), err, "unable to generate the DPoP key")
+
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+	s.client = &auth.Client{
+		Tenant: strings.TrimPrefix(s.server.URL, "https://"),
+		ClientAuth: &auth.ClientSecretPost{
+			ClientID:     "clientID",
+			ClientSecret: "clientSecret",
+		},
+		DPoP: dpopKey,
+	}
+}
+
+func (s *DPoPTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *DPoPTestSuite) TestTokenWithNonceRetry() {
+	t, err := s.client.TokenWithAPIClient(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to get a DPoP-bound token")
+	require.Equal(s.T(), "DPoP", t.TokenType)
+
+	require.Len(s.T(), s.proofs, 2, "the request should be retried with the nonce")
+	require.Equal(s.T(), http.MethodPost, s.proofs[1]["htm"])
+	require.Equal(s.T(), s.server.URL+"/oauth2/token", s.proofs[1]["htu"])
+	require.NotEqual(s.T(), s.proofs[0]["jti"], s.proofs[1]["jti"])
+
+	// the nonce is remembered for subsequent requests
+	_, err = s.client.TokenWithRefreshToken(s.ctx, "refresh", nil)
+	require.NoError(s.T(), err, "unable to refresh the DPoP-bound token")
+	require.Len(s.T(), s.proofs, 3)
+}
+
+func (s *DPoPTestSuite) TestAuthorizationCodeBinding() {
+	authResponse, err := s.client.AuthorizeWithBrowserFlow(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to build the authorization URL")
+
+	jkt, err := s.client.DPoP.Thumbprint()
+	require.NoError(s.T(), err, "unable to compute the thumbprint")
+	require.Contains(s.T(), authResponse.AuthCodeURL, "dpop_jkt="+jkt)
+}
+
+func TestDPoPTestSuite(t *testing.T) {
+	suite.Run(t, new(DPoPTestSuite))
+}
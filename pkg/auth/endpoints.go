@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+type endpoint int
+
+const (
+	authorizationEndpoint endpoint = iota
+	tokenEndpoint
+	deviceAuthorizationEndpoint
+	pushedAuthorizationRequestEndpoint
+	introspectionEndpoint
+	revocationEndpoint
+	userinfoEndpoint
+	jwksEndpoint
+	backchannelAuthenticationEndpoint
+	endSessionEndpoint
+	registrationEndpoint
+)
+
+// defaultEndpointPaths contains the paths used when the endpoints are not resolved
+// from the discovery document.
+var defaultEndpointPaths = map[endpoint]string{
+	authorizationEndpoint:              "/oauth2/authorize",
+	tokenEndpoint:                      "/oauth2/token",
+	deviceAuthorizationEndpoint:        "/oauth2/device_authorization",
+	pushedAuthorizationRequestEndpoint: "/oauth2/par",
+	introspectionEndpoint:              "/oauth2/introspect",
+	revocationEndpoint:                 "/oauth2/revoke",
+	userinfoEndpoint:                   "/oauth2/userinfo",
+	jwksEndpoint:                       "/oauth2/jwks",
+	backchannelAuthenticationEndpoint:  "/oauth2/backchannel_authentication",
+	endSessionEndpoint:                 "/idaas/mtfim/sps/idaas/logout",
+	registrationEndpoint:               "/oauth2/register",
+}
+
+func (e endpoint) String() string {
+	switch e {
+	case authorizationEndpoint:
+		return "authorization_endpoint"
+	case tokenEndpoint:
+		return "token_endpoint"
+	case deviceAuthorizationEndpoint:
+		return "device_authorization_endpoint"
+	case pushedAuthorizationRequestEndpoint:
+		return "pushed_authorization_request_endpoint"
+	case introspectionEndpoint:
+		return "introspection_endpoint"
+	case revocationEndpoint:
+		return "revocation_endpoint"
+	case userinfoEndpoint:
+		return "userinfo_endpoint"
+	case jwksEndpoint:
+		return "jwks_uri"
+	case backchannelAuthenticationEndpoint:
+		return "backchannel_authentication_endpoint"
+	case endSessionEndpoint:
+		return "end_session_endpoint"
+	case registrationEndpoint:
+		return "registration_endpoint"
+	}
+
+	return "unknown"
+}
+
+// authenticatesClient reports whether the client authenticates using the ClientAuth when
+// calling the endpoint.
+func (e endpoint) authenticatesClient() bool {
+	switch e {
+	case tokenEndpoint, deviceAuthorizationEndpoint, pushedAuthorizationRequestEndpoint,
+		introspectionEndpoint, revocationEndpoint, backchannelAuthenticationEndpoint:
+		return true
+	}
+
+	return false
+}
+
+// issuer returns the default issuer of the tenant, which is used when Discovery is not configured.
+func (c *Client) issuer() string {
+	return fmt.Sprintf("https://%s/oauth2", c.Tenant)
+}
+
+// endpoint resolves the URL of the endpoint. If Discovery is configured on the client, the URL
+// is taken from the discovery document, using the mutual-TLS endpoint aliases when the client
+// authenticates with a certificate. Otherwise, the default path on the tenant is used.
+func (c *Client) endpoint(ctx context.Context, e endpoint) (string, error) {
+	if c.Discovery == nil {
+		return fmt.Sprintf("https://%s%s", c.Tenant, defaultEndpointPaths[e]), nil
+	}
+
+	config, err := c.Discovery.Configuration(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var u string
+	switch e {
+	case authorizationEndpoint:
+		u = config.AuthorizationEndpoint
+	case tokenEndpoint:
+		u = config.TokenEndpoint
+	case deviceAuthorizationEndpoint:
+		u = config.DeviceAuthorizationEndpoint
+	case pushedAuthorizationRequestEndpoint:
+		u = config.PushedAuthorizationRequestEndpoint
+	case introspectionEndpoint:
+		u = config.IntrospectionEndpoint
+	case revocationEndpoint:
+		u = config.RevocationEndpoint
+	case userinfoEndpoint:
+		u = config.UserinfoEndpoint
+	case jwksEndpoint:
+		u = config.JSONWebKeySetURI
+	case backchannelAuthenticationEndpoint:
+		u = config.BackchannelAuthenticationEndpoint
+	case endSessionEndpoint:
+		u = config.EndSessionEndpoint
+	case registrationEndpoint:
+		u = config.RegistrationEndpoint
+	}
+
+	// prefer the mutual-TLS endpoint aliases when authenticating with a client certificate
+	if _, ok := c.ClientAuth.(certificateClientAuth); ok && config.MTLSEndpointAliases != nil {
+		aliases := config.MTLSEndpointAliases
+		alias := ""
+		switch e {
+		case tokenEndpoint:
+			alias = aliases.TokenEndpoint
+		case pushedAuthorizationRequestEndpoint:
+			alias = aliases.PushedAuthorizationRequestEndpoint
+		case introspectionEndpoint:
+			alias = aliases.IntrospectionEndpoint
+		case revocationEndpoint:
+			alias = aliases.RevocationEndpoint
+		}
+
+		if alias != "" {
+			u = alias
+		}
+	}
+
+	if u == "" {
+		return "", errorsx.G11NError("'%s' is not available in the discovery document.", e.String())
+	}
+
+	return u, nil
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrInvalidRequest is returned when the request is missing a parameter or is otherwise malformed.
+	ErrInvalidRequest = &OAuthError{Code: "invalid_request"}
+
+	// ErrInvalidClient is returned when the client authentication failed.
+	ErrInvalidClient = &OAuthError{Code: "invalid_client"}
+
+	// ErrUnauthorizedClient is returned when the client is not allowed to use the grant type.
+	ErrUnauthorizedClient = &OAuthError{Code: "unauthorized_client"}
+
+	// ErrUnsupportedGrantType is returned when the grant type is not supported by the authorization server.
+	ErrUnsupportedGrantType = &OAuthError{Code: "unsupported_grant_type"}
+
+	// ErrInvalidScope is returned when a requested scope is invalid, unknown or exceeds the scopes
+	// granted to the client.
+	ErrInvalidScope = &OAuthError{Code: "invalid_scope"}
+
+	// ErrInvalidToken is returned by resource servers, such as the UserInfo endpoint, when the
+	// access token is expired, revoked or otherwise invalid.
+	ErrInvalidToken = &OAuthError{Code: "invalid_token"}
+
+	// ErrInsufficientScope is returned by resource servers when the access token does not have
+	// the scopes required by the request.
+	ErrInsufficientScope = &OAuthError{Code: "insufficient_scope"}
+
+	// ErrLoginRequired is returned in the authorization response when prompt=none was requested
+	// and the user is not authenticated.
+	ErrLoginRequired = &OAuthError{Code: "login_required"}
+
+	// ErrConsentRequired is returned in the authorization response when prompt=none was requested
+	// and the user has not consented.
+	ErrConsentRequired = &OAuthError{Code: "consent_required"}
+
+	// ErrInteractionRequired is returned in the authorization response when prompt=none was requested
+	// and the user must interact with the authorization server.
+	ErrInteractionRequired = &OAuthError{Code: "interaction_required"}
+
+	// ErrStateMismatch is returned by TokenWithAuthCode when the state of the authorization response
+	// does not match the state of the request, which may indicate a forged response. This code is
+	// not sent by the authorization server.
+	ErrStateMismatch = &OAuthError{Code: "state_mismatch"}
+
+	// ErrInvalidGrant is returned when the authorization grant or refresh token is invalid, expired,
+	// revoked or was issued to another client. Use errors.Is to check for it.
+	ErrInvalidGrant = &OAuthError{Code: "invalid_grant"}
+
+	// ErrAuthorizationPending is returned while the user has not yet completed a device or
+	// backchannel authentication flow.
+	ErrAuthorizationPending = &OAuthError{Code: "authorization_pending"}
+
+	// ErrSlowDown is returned when the client polls for the token too often.
+	ErrSlowDown = &OAuthError{Code: "slow_down"}
+
+	// ErrExpiredToken is returned when the device code or auth_req_id has expired.
+	ErrExpiredToken = &OAuthError{Code: "expired_token"}
+
+	// ErrAccessDenied is returned when the user or the authorization server denied the request.
+	ErrAccessDenied = &OAuthError{Code: "access_denied"}
+
+	// ErrAccountLocked is returned by the password grant when the user account is locked or disabled.
+	ErrAccountLocked = &OAuthError{Code: "account_locked"}
+
+	// ErrPasswordExpired is returned by the password grant when the password must be changed
+	// before the user can authenticate.
+	ErrPasswordExpired = &OAuthError{Code: "password_expired"}
+
+	// ErrMFARequired is returned by the password grant when the user must complete multi-factor
+	// authentication, which the password grant cannot perform.
+	ErrMFARequired = &OAuthError{Code: "mfa_required"}
+)
+
+// OAuthError is the error response returned by the authorization server, as described
+// in RFC 6749 section 5.2.
+type OAuthError struct {
+	// Code is the error code, such as invalid_grant.
+	Code string `json:"error"`
+
+	// Description is the human-readable text providing additional information.
+	Description string `json:"error_description,omitempty"`
+
+	// URI identifies a human-readable web page with information about the error.
+	URI string `json:"error_uri,omitempty"`
+
+	// StatusCode is the HTTP status code of the response, or 0 if the error was returned in the
+	// authorization response.
+	StatusCode int `json:"-"`
+
+	// Challenges contains the challenges of the WWW-Authenticate header of the response, if any.
+	Challenges []Challenge `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Code == "" {
+		if e.Description == "" {
+			return fmt.Sprintf("error: unexpected response, status: %d", e.StatusCode)
+		}
+
+		return fmt.Sprintf("error: unexpected response, status: %d, description: %s", e.StatusCode, e.Description)
+	}
+
+	if e.Description == "" {
+		return fmt.Sprintf("error: %s", e.Code)
+	}
+
+	return fmt.Sprintf("error: %s, description: %s", e.Code, e.Description)
+}
+
+// Is reports whether the target is an OAuthError with the same error code.
+func (e *OAuthError) Is(target error) bool {
+	t, ok := target.(*OAuthError)
+	return ok && t.Code == e.Code
+}
+
+// Challenge is an authentication challenge from the WWW-Authenticate header, as described in
+// RFC 9110 section 11.6.1, such as the Bearer challenge of RFC 6750 section 3.
+type Challenge struct {
+	// Scheme is the authentication scheme, such as Bearer or DPoP.
+	Scheme string
+
+	// Params contains the auth parameters, such as error and realm, by lower-case name.
+	Params map[string]string
+}
+
+// ParseWWWAuthenticate parses the challenges of a WWW-Authenticate header. Parts of the header
+// that cannot be parsed, such as token68 credentials, are skipped.
+func ParseWWWAuthenticate(header string) []Challenge {
+	var challenges []Challenge
+	p := &headerParser{s: header}
+	for {
+		p.skip(", \t")
+		if p.done() {
+			return challenges
+		}
+
+		scheme := p.token()
+		if scheme == "" {
+			p.i++
+			continue
+		}
+
+		challenge := Challenge{Scheme: scheme, Params: map[string]string{}}
+		for {
+			p.skip(" \t")
+			start := p.i
+			name := p.token()
+			p.skip(" \t")
+			if name == "" || !p.consume('=') {
+				// the token is the scheme of the next challenge
+				p.i = start
+				break
+			}
+
+			p.skip(" \t")
+			if p.peek() == '"' {
+				challenge.Params[strings.ToLower(name)] = p.quoted()
+			} else if value := p.token(); value != "" || p.peek() != '=' {
+				challenge.Params[strings.ToLower(name)] = value
+			} else {
+				// token68 credentials with padding, which are not parameters
+				p.skip("=")
+			}
+
+			p.skip(" \t")
+			if !p.consume(',') {
+				break
+			}
+		}
+
+		challenges = append(challenges, challenge)
+	}
+}
+
+// headerParser reads the tokens and quoted strings of an HTTP header.
+type headerParser struct {
+	s string
+	i int
+}
+
+func (p *headerParser) done() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *headerParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+
+	return p.s[p.i]
+}
+
+func (p *headerParser) consume(c byte) bool {
+	if p.peek() != c || p.done() {
+		return false
+	}
+
+	p.i++
+	return true
+}
+
+func (p *headerParser) skip(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// token reads a token, as described in RFC 9110 section 5.6.2.
+func (p *headerParser) token() string {
+	start := p.i
+	for !p.done() {
+		c := p.s[p.i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			break
+		}
+
+		p.i++
+	}
+
+	return p.s[start:p.i]
+}
+
+// quoted reads a quoted string, removing the quotes and escapes.
+func (p *headerParser) quoted() string {
+	sb := &strings.Builder{}
+	p.i++
+	for !p.done() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '"':
+			return sb.String()
+		case c == '\\' && !p.done():
+			sb.WriteByte(p.s[p.i])
+			p.i++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
+// newOAuthErrorFromHeader returns the error with the challenges of the response. Resource servers,
+// such as the UserInfo endpoint, return the error code in the challenge rather than the body.
+func newOAuthErrorFromHeader(oauthErr *OAuthError, header http.Header) *OAuthError {
+	oauthErr.Challenges = ParseWWWAuthenticate(strings.Join(header.Values("WWW-Authenticate"), ", "))
+	if oauthErr.Code != "" {
+		return oauthErr
+	}
+
+	for _, challenge := range oauthErr.Challenges {
+		if code := challenge.Params["error"]; code != "" {
+			oauthErr.Code = code
+			oauthErr.Description = challenge.Params["error_description"]
+			oauthErr.URI = challenge.Params["error_uri"]
+			break
+		}
+	}
+
+	return oauthErr
+}
+
+// convertRetrieveError converts the oauth2.RetrieveError returned by the grants implemented
+// using golang.org/x/oauth2 into an OAuthError. Other errors are returned unchanged.
+func convertRetrieveError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) || retrieveErr.Response == nil {
+		return err
+	}
+
+	if retrieveErr.ErrorCode == "" {
+		return newResponseError(retrieveErr.Response, retrieveErr.Body)
+	}
+
+	return newOAuthErrorFromHeader(&OAuthError{
+		Code:        retrieveErr.ErrorCode,
+		Description: retrieveErr.ErrorDescription,
+		URI:         retrieveErr.ErrorURI,
+		StatusCode:  retrieveErr.Response.StatusCode,
+	}, retrieveErr.Response.Header)
+}
+
+// newCallbackError returns the error in the parameters of the authorization response, if any.
+func newCallbackError(callbackParams url.Values) error {
+	if callbackParams.Get("error") == "" {
+		return nil
+	}
+
+	return &OAuthError{
+		Code:        callbackParams.Get("error"),
+		Description: callbackParams.Get("error_description"),
+		URI:         callbackParams.Get("error_uri"),
+	}
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+const (
+	// DefaultClockSkew is the leeway allowed when validating time based claims.
+	DefaultClockSkew = 1 * time.Minute
+)
+
+// IDTokenClaims contains the claims of a validated ID token.
+type IDTokenClaims struct {
+	jwt.Claims
+
+	// Nonce is the value used to associate the client session with the ID token.
+	Nonce string `json:"nonce,omitempty"`
+
+	// AccessTokenHash is the at_hash claim.
+	AccessTokenHash string `json:"at_hash,omitempty"`
+
+	// CodeHash is the c_hash claim.
+	CodeHash string `json:"c_hash,omitempty"`
+
+	// AuthorizedParty is the client_id of the party to which the ID token was issued.
+	AuthorizedParty string `json:"azp,omitempty"`
+
+	// AuthTime is the time when the user authentication occurred in seconds since the epoch.
+	AuthTime int64 `json:"auth_time,omitempty"`
+
+	// ACR is the Authentication Context Class Reference.
+	ACR string `json:"acr,omitempty"`
+
+	// AMR lists the Authentication Methods References.
+	AMR []string `json:"amr,omitempty"`
+
+	// SessionID is the sid claim that identifies the session at the OP.
+	SessionID string `json:"sid,omitempty"`
+
+	// Raw contains all the claims in the ID token, including those that are not well known.
+	Raw typesx.Map `json:"-"`
+}
+
+// IDTokenVerifyOptions contains the values the ID token is expected to be bound to.
+type IDTokenVerifyOptions struct {
+	// Nonce is the nonce sent in the authorization request. If set, the nonce claim must match.
+	Nonce string
+
+	// AccessToken is the access token issued with the ID token. If set and the ID token
+	// contains the at_hash claim, the hash must match.
+	AccessToken string
+
+	// Code is the authorization code issued with the ID token. If set and the ID token
+	// contains the c_hash claim, the hash must match.
+	Code string
+}
+
+// IDTokenVerifier validates ID tokens issued by the tenant. The signing keys are fetched
+// from the jwks_uri in the discovery document and cached. It is safe for concurrent use.
+type IDTokenVerifier struct {
+	// ClientID is the client_id of the application the ID tokens are issued to.
+	ClientID string
+
+	// Discovery provides the issuer, jwks_uri and supported signing algorithms.
+	Discovery *Discovery
+
+	// KeySet optionally overrides the key set used to verify signatures. By default,
+	// the RemoteKeySet for the jwks_uri in the discovery document is used, which is shared
+	// with the other verifiers and clients using the same jwks_uri.
+	KeySet *RemoteKeySet
+
+	// ClockSkew is the leeway allowed when validating exp and iat. By default, this is
+	// set to DefaultClockSkew.
+	ClockSkew time.Duration
+}
+
+// NewIDTokenVerifier returns an IDTokenVerifier for ID tokens issued to the client.
+func NewIDTokenVerifier(discovery *Discovery, clientID string) *IDTokenVerifier {
+	return &IDTokenVerifier{
+		ClientID:  clientID,
+		Discovery: discovery,
+	}
+}
+
+// VerifyTokenResponse validates the ID token in the token response, using the nonce in
+// the authorize response, if provided, and the access token in the token response.
+func (v *IDTokenVerifier) VerifyTokenResponse(ctx context.Context, tokenResponse *TokenResponse, authResponse *AuthorizeResponse) (*IDTokenClaims, error) {
+	if tokenResponse == nil || tokenResponse.IDToken == "" {
+		return nil, errorsx.G11NError("the token response does not contain an ID token")
+	}
+
+	opts := &IDTokenVerifyOptions{
+		AccessToken: tokenResponse.AccessToken,
+	}
+
+	if authResponse != nil {
+		opts.Nonce = authResponse.Nonce
+	}
+
+	return v.Verify(ctx, tokenResponse.IDToken, opts)
+}
+
+// Verify validates the signature of the ID token and the iss, aud, azp, exp, iat, nonce,
+// at_hash and c_hash claims, and returns the claims.
+func (v *IDTokenVerifier) Verify(ctx context.Context, rawIDToken string, opts *IDTokenVerifyOptions) (*IDTokenClaims, error) {
+	if opts == nil {
+		opts = &IDTokenVerifyOptions{}
+	}
+
+	config, err := v.Discovery.Configuration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet, err := remoteKeySet(v.KeySet, config.JSONWebKeySetURI)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	alg, err := verifyJWT(ctx, keySet, rawIDToken, config.IDTokenSigningAlgValuesSupported, claims, &claims.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Expiry == nil || claims.IssuedAt == nil {
+		return nil, errorsx.G11NError("the ID token must contain 'exp' and 'iat'")
+	}
+
+	if err := claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:      config.Issuer,
+		AnyAudience: jwt.Audience{v.ClientID},
+	}, v.clockSkew()); err != nil {
+		return nil, errorsx.G11NError("the ID token is invalid; err=%v", err)
+	}
+
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != v.ClientID {
+		return nil, errorsx.G11NError("the ID token 'azp' does not match the client")
+	}
+
+	if opts.Nonce != "" && subtle.ConstantTimeCompare([]byte(opts.Nonce), []byte(claims.Nonce)) != 1 {
+		return nil, errorsx.G11NError("the ID token 'nonce' does not match")
+	}
+
+	if opts.AccessToken != "" && claims.AccessTokenHash != "" {
+		if err := verifyTokenHash(alg, opts.AccessToken, claims.AccessTokenHash); err != nil {
+			return nil, errorsx.G11NError("the ID token 'at_hash' does not match the access token")
+		}
+	}
+
+	if opts.Code != "" && claims.CodeHash != "" {
+		if err := verifyTokenHash(alg, opts.Code, claims.CodeHash); err != nil {
+			return nil, errorsx.G11NError("the ID token 'c_hash' does not match the authorization code")
+		}
+	}
+
+	return claims, nil
+}
+
+func (v *IDTokenVerifier) clockSkew() time.Duration {
+	if v.ClockSkew == 0 {
+		return DefaultClockSkew
+	}
+
+	return v.ClockSkew
+}
+
+// signatureAlgorithms converts the supported algorithms advertised in the discovery
+// document to the list accepted for signature verification. The 'none' algorithm is
+// never accepted and RS256 is used when nothing is advertised.
+func signatureAlgorithms(supported []string) []jose.SignatureAlgorithm {
+	var algs []jose.SignatureAlgorithm
+	for _, alg := range supported {
+		if alg != "none" {
+			algs = append(algs, jose.SignatureAlgorithm(alg))
+		}
+	}
+
+	if len(algs) == 0 {
+		algs = []jose.SignatureAlgorithm{jose.RS256}
+	}
+
+	return algs
+}
+
+// verifyJWT verifies the signature of the JWT using the key set and unmarshals the claims
+// into each of the destinations. The signing algorithm is returned.
+func verifyJWT(ctx context.Context, keySet *RemoteKeySet, raw string, supportedAlgs []string, dest ...any) (jose.SignatureAlgorithm, error) {
+	token, err := jwt.ParseSigned(raw, signatureAlgorithms(supportedAlgs))
+	if err != nil {
+		return "", errorsx.G11NError("unable to parse the token; err=%v", err)
+	}
+
+	if len(token.Headers) != 1 {
+		return "", errorsx.G11NError("the token must have a single signature")
+	}
+
+	header := token.Headers[0]
+	key, err := keySet.Key(ctx, header.KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := token.Claims(key, dest...); err != nil {
+		return "", errorsx.G11NError("unable to verify the token; err=%v", err)
+	}
+
+	return jose.SignatureAlgorithm(header.Algorithm), nil
+}
+
+// tokenHash computes the at_hash or c_hash value of the token, which is the base64url
+// encoding of the left-most half of the hash of the token, using the hash algorithm of
+// the JWS signing algorithm.
+func tokenHash(alg jose.SignatureAlgorithm, token string) (string, error) {
+	var h crypto.Hash
+	switch alg {
+	case jose.RS256, jose.ES256, jose.PS256, jose.HS256:
+		h = crypto.SHA256
+	case jose.RS384, jose.ES384, jose.PS384, jose.HS384:
+		h = crypto.SHA384
+	case jose.RS512, jose.ES512, jose.PS512, jose.HS512, jose.EdDSA:
+		h = crypto.SHA512
+	default:
+		return "", errorsx.G11NError("unsupported algorithm '%s'", string(alg))
+	}
+
+	hasher := h.New()
+	hasher.Write([]byte(token))
+	sum := hasher.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+func verifyTokenHash(alg jose.SignatureAlgorithm, token string, expected string) error {
+	actual, err := tokenHash(alg, token)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) != 1 {
+		return errorsx.G11NError("the hash does not match")
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type IDTokenTestSuite struct {
+	suite.Suite
+
+	ctx      context.Context
+	server   *httptest.Server
+	issuer   string
+	keys     []jose.JSONWebKey
+	jwksDown bool
+	fetches  int
+	verifier *auth.IDTokenVerifier
+}
+
+func newSigningKey(t *testing.T, kid string) jose.JSONWebKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "unable to generate a key")
+	return jose.JSONWebKey{Key: key, KeyID: kid, Algorithm: string(jose.RS256), Use: "sig"}
+}
+
+func signJWT(t *testing.T, key jose.JSONWebKey, claims any) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err, "unable to create a signer")
+	raw, err := jwt.Signed(signer).Claims(claims).Serialize()
+	require.NoError(t, err, "unable to sign the token")
+	return raw
+}
+
+func (s *IDTokenTestSuite) SetupTest() {
+	s.keys = []jose.JSONWebKey{newSigningKey(s.T(), "key1")}
+	s.jwksDown = false
+	s.fetches = 0
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2" + auth.DiscoveryEndpoint:
+			writeJSON(w, http.StatusOK, map[string]any{
+				"issuer":                                s.issuer,
+				"jwks_uri":                              s.issuer + "/jwks",
+				"id_token_signing_alg_values_supported": []string{"RS256"},
+			})
+		case "/oauth2/jwks":
+			s.fetches++
+			if s.jwksDown {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			set := jose.JSONWebKeySet{}
+			for _, k := range s.keys {
+				set.Keys = append(set.Keys, k.Public())
+			}
+			writeJSON(w, http.StatusOK, set)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	tenant := strings.TrimPrefix(s.server.URL, "https://")
+	s.issuer = "https://" + tenant + "/oauth2"
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+	s.verifier = auth.NewIDTokenVerifier(auth.NewDiscovery(tenant), "clientID")
+	s.verifier.KeySet = auth.NewRemoteKeySet(s.issuer + "/jwks")
+}
+
+func (s *IDTokenTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *IDTokenTestSuite) claims() map[string]any {
+	sum := sha256.Sum256([]byte("access"))
+	return map[string]any{
+		"iss":     s.issuer,
+		"sub":     "user",
+		"aud":     "clientID",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+		"iat":     time.Now().Unix(),
+		"nonce":   "nonce",
+		"at_hash": base64.RawURLEncoding.EncodeToString(sum[:16]),
+		"email":   "user@example.com",
+	}
+}
+
+func (s *IDTokenTestSuite) TestVerifyTokenResponse() {
+	tr := &auth.TokenResponse{
+		AccessToken: "access",
+		IDToken:     signJWT(s.T(), s.keys[0], s.claims()),
+	}
+
+	claims, err := s.verifier.VerifyTokenResponse(s.ctx, tr, &auth.AuthorizeResponse{Nonce: "nonce"})
+	require.NoError(s.T(), err, "unable to verify the ID token")
+	require.Equal(s.T(), "user", claims.Subject)
+	require.Equal(s.T(), "user@example.com", claims.Raw.SafeString("email", ""))
+
+	_, err = s.verifier.VerifyTokenResponse(s.ctx, tr, &auth.AuthorizeResponse{Nonce: "other"})
+	require.Error(s.T(), err, "the nonce should be validated")
+
+	tr.AccessToken = "other"
+	_, err = s.verifier.VerifyTokenResponse(s.ctx, tr, nil)
+	require.Error(s.T(), err, "the at_hash should be validated")
+}
+
+func (s *IDTokenTestSuite) TestInvalidClaims() {
+	for name, mutate := range map[string]func(map[string]any){
+		"issuer":   func(c map[string]any) { c["iss"] = "https://attacker.example.com" },
+		"audience": func(c map[string]any) { c["aud"] = "other" },
+		"expired":  func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"azp":      func(c map[string]any) { c["aud"] = []string{"clientID", "other"} },
+		"iat":      func(c map[string]any) { delete(c, "iat") },
+	} {
+		claims := s.claims()
+		mutate(claims)
+		_, err := s.verifier.Verify(s.ctx, signJWT(s.T(), s.keys[0], claims), nil)
+		require.Error(s.T(), err, "expected %s to be rejected", name)
+	}
+}
+
+func (s *IDTokenTestSuite) TestKeyRotation() {
+	_, err := s.verifier.Verify(s.ctx, signJWT(s.T(), s.keys[0], s.claims()), nil)
+	require.NoError(s.T(), err, "unable to verify the ID token")
+
+	s.verifier.KeySet.MinRefreshInterval = time.Nanosecond
+	s.keys = append(s.keys, newSigningKey(s.T(), "key2"))
+	_, err = s.verifier.Verify(s.ctx, signJWT(s.T(), s.keys[1], s.claims()), nil)
+	require.NoError(s.T(), err, "the key set should be fetched again for an unknown key")
+}
+
+func (s *IDTokenTestSuite) TestKeySetOutage() {
+	s.jwksDown = true
+	for i := 0; i < 3; i++ {
+		_, err := s.verifier.Verify(s.ctx, signJWT(s.T(), s.keys[0], s.claims()), nil)
+		require.Error(s.T(), err, "the key set is unavailable")
+	}
+	require.Equal(s.T(), 1, s.fetches, "a failed fetch should not be retried before the minimum refresh interval")
+
+	s.jwksDown = false
+	s.verifier.KeySet.MinRefreshInterval = time.Nanosecond
+	_, err := s.verifier.Verify(s.ctx, signJWT(s.T(), s.keys[0], s.claims()), nil)
+	require.NoError(s.T(), err, "the key set should be fetched again after the minimum refresh interval")
+	require.Equal(s.T(), 2, s.fetches)
+}
+
+func (s *IDTokenTestSuite) TestStaleKeySet() {
+	_, err := s.verifier.Verify(s.ctx, signJWT(s.T(), s.keys[0], s.claims()), nil)
+	require.NoError(s.T(), err, "unable to verify the ID token")
+
+	s.verifier.KeySet.TTL = time.Nanosecond
+	s.jwksDown = true
+	for i := 0; i < 3; i++ {
+		_, err = s.verifier.Verify(s.ctx, signJWT(s.T(), s.keys[0], s.claims()), nil)
+		require.NoError(s.T(), err, "the cached keys should be used when the key set cannot be fetched again")
+	}
+	require.Equal(s.T(), 2, s.fetches, "a failed fetch should not be retried before the minimum refresh interval")
+}
+
+func (s *IDTokenTestSuite) TestSharedKeySet() {
+	verifier := auth.NewIDTokenVerifier(s.verifier.Discovery, "clientID")
+	other := auth.NewIDTokenVerifier(s.verifier.Discovery, "clientID")
+	for _, v := range []*auth.IDTokenVerifier{verifier, other} {
+		_, err := v.Verify(s.ctx, signJWT(s.T(), s.keys[0], s.claims()), nil)
+		require.NoError(s.T(), err, "unable to verify the ID token")
+	}
+	require.Equal(s.T(), 1, s.fetches, "the key set should be shared by the verifiers using the jwks_uri")
+	require.Nil(s.T(), verifier.KeySet, "the verifier should not be modified")
+}
+
+func TestIDTokenTestSuite(t *testing.T) {
+	suite.Run(t, new(IDTokenTestSuite))
+}
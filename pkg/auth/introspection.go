@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+const (
+	// TokenTypeHintAccessToken indicates that the token is an access token.
+	TokenTypeHintAccessToken = "access_token"
+
+	// TokenTypeHintRefreshToken indicates that the token is a refresh token.
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// IntrospectionResponse is the result of token introspection, as described in RFC 7662.
+type IntrospectionResponse struct {
+	// Active indicates whether the token is currently active. All other fields
+	// are only populated for active tokens.
+	Active bool
+
+	// Scope is the space-delimited list of scopes associated with the token.
+	Scope string
+
+	// ClientID is the identifier of the client that requested the token.
+	ClientID string
+
+	// Username is the human-readable identifier of the resource owner.
+	Username string
+
+	// TokenType is the type of the token, such as Bearer.
+	TokenType string
+
+	// Subject is the subject of the token.
+	Subject string
+
+	// Audience lists the intended audiences of the token.
+	Audience []string
+
+	// Issuer is the issuer of the token.
+	Issuer string
+
+	// ExpiresAt is the expiry of the token in seconds since the epoch.
+	ExpiresAt int64
+
+	// IssuedAt is the time the token was issued in seconds since the epoch.
+	IssuedAt int64
+
+	// NotBefore is the time before which the token must not be accepted in seconds since the epoch.
+	NotBefore int64
+
+	// Claims contains all the properties returned by the introspection endpoint,
+	// including those that are not well known.
+	Claims typesx.Map
+}
+
+// IntrospectToken determines the state of the token using the introspection endpoint
+// described in RFC 7662, authenticating with the configured ClientAuth. The tokenTypeHint
+// is optional and is either TokenTypeHintAccessToken or TokenTypeHintRefreshToken.
+//
+// An inactive token is not an error; the returned IntrospectionResponse has Active set to false.
+func (c *Client) IntrospectToken(ctx context.Context, token string, tokenTypeHint string) (*IntrospectionResponse, error) {
+	if token == "" {
+		return nil, errorsx.G11NError("'token' is required.")
+	}
+
+	params := url.Values{}
+	params.Set("token", token)
+	if tokenTypeHint != "" {
+		params.Set("token_type_hint", tokenTypeHint)
+	}
+
+	res, body, err := c.postForm(ctx, introspectionEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newResponseError(res, body)
+	}
+
+	claims := typesx.Map{}
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, errorsx.G11NError("unable to parse the introspection response; err=%v", err)
+	}
+
+	return &IntrospectionResponse{
+		Active:    claims.SafeBool("active", false),
+		Scope:     claims.SafeString("scope", ""),
+		ClientID:  claims.SafeString("client_id", ""),
+		Username:  claims.SafeString("username", ""),
+		TokenType: claims.SafeString("token_type", ""),
+		Subject:   claims.SafeString("sub", ""),
+		Audience:  claims.SafeStringSlice("aud", nil),
+		Issuer:    claims.SafeString("iss", ""),
+		ExpiresAt: claims.SafeInt64("exp", 0),
+		IssuedAt:  claims.SafeInt64("iat", 0),
+		NotBefore: claims.SafeInt64("nbf", 0),
+		Claims:    claims,
+	}, nil
+}
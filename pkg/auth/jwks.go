@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+const (
+	// DefaultJWKSCacheTTL is how long a fetched JSON Web Key Set is cached by default.
+	DefaultJWKSCacheTTL = 24 * time.Hour
+
+	// DefaultJWKSMinRefreshInterval is the minimum interval between fetches triggered
+	// by an unknown key ID or following a failed fetch.
+	DefaultJWKSMinRefreshInterval = 1 * time.Minute
+)
+
+// RemoteKeySet fetches the JSON Web Key Set published at a URI, such as the jwks_uri of
+// the tenant, and caches it. When a key ID is not found in the cached set, the set is
+// fetched again to pick up rotated keys. After a failed fetch, the key set is not fetched
+// again until MinRefreshInterval has passed. In the meantime, the previously fetched keys
+// are used, even once they are older than the TTL, or the error is returned if none were
+// fetched. It is safe for concurrent use.
+type RemoteKeySet struct {
+	// URI is the location of the JSON Web Key Set.
+	URI string
+
+	// TTL specifies how long the fetched key set is cached. By default, this is
+	// set to DefaultJWKSCacheTTL.
+	TTL time.Duration
+
+	// MinRefreshInterval limits how often the key set is fetched again because of an
+	// unknown key ID or a failed fetch. By default, this is set to DefaultJWKSMinRefreshInterval.
+	MinRefreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      *jose.JSONWebKeySet
+	fetchedAt time.Time
+	failedAt  time.Time
+	fetchErr  error
+}
+
+// sharedKeySets holds the RemoteKeySet of each jwks_uri used by the clients, verifiers and
+// resource servers that do not set a KeySet, so the keys are not fetched on every call.
+var sharedKeySets sync.Map
+
+// remoteKeySet returns the key set if set, or the RemoteKeySet shared by the callers using
+// the jwks_uri.
+func remoteKeySet(keySet *RemoteKeySet, jwksURI string) (*RemoteKeySet, error) {
+	if keySet != nil {
+		return keySet, nil
+	}
+
+	if jwksURI == "" {
+		return nil, errorsx.G11NError("'jwks_uri' is not available in the discovery document.")
+	}
+
+	shared, _ := sharedKeySets.LoadOrStore(jwksURI, NewRemoteKeySet(jwksURI))
+	return shared.(*RemoteKeySet), nil
+}
+
+// NewRemoteKeySet returns a RemoteKeySet for the JSON Web Key Set published at the URI.
+func NewRemoteKeySet(uri string) *RemoteKeySet {
+	return &RemoteKeySet{
+		URI: uri,
+	}
+}
+
+// Key returns the public key with the key ID. If the key ID is empty and the key set
+// contains a single key, that key is returned.
+func (k *RemoteKeySet) Key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	ttl := k.TTL
+	if ttl == 0 {
+		ttl = DefaultJWKSCacheTTL
+	}
+
+	minRefresh := k.MinRefreshInterval
+	if minRefresh == 0 {
+		minRefresh = DefaultJWKSMinRefreshInterval
+	}
+
+	if k.keys == nil || time.Since(k.fetchedAt) >= ttl {
+		// the cached keys remain valid until they are replaced
+		if err := k.refresh(ctx, minRefresh); err != nil && k.keys == nil {
+			return nil, &unavailableError{err: err}
+		}
+	}
+
+	if key := k.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	// the key may have been rotated
+	if time.Since(k.fetchedAt) >= minRefresh {
+		if err := k.refresh(ctx, minRefresh); err != nil {
+			return nil, &unavailableError{err: err}
+		}
+
+		if key := k.lookup(kid); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, errorsx.G11NError("the key '%s' is not found in the key set", kid)
+}
+
+// refresh fetches the key set, unless a fetch failed within the minimum refresh interval,
+// in which case the error of that fetch is returned.
+func (k *RemoteKeySet) refresh(ctx context.Context, minRefresh time.Duration) error {
+	if k.fetchErr != nil && time.Since(k.failedAt) < minRefresh {
+		return k.fetchErr
+	}
+
+	if err := k.fetch(ctx); err != nil {
+		// a cancelled request says nothing about the availability of the key set
+		if ctx.Err() == nil {
+			k.fetchErr = err
+			k.failedAt = time.Now()
+		}
+
+		return err
+	}
+
+	k.fetchErr = nil
+	return nil
+}
+
+func (k *RemoteKeySet) lookup(kid string) *jose.JSONWebKey {
+	if kid == "" {
+		if len(k.keys.Keys) == 1 {
+			return &k.keys.Keys[0]
+		}
+
+		return nil
+	}
+
+	if keys := k.keys.Key(kid); len(keys) > 0 {
+		return &keys[0]
+	}
+
+	return nil
+}
+
+func (k *RemoteKeySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.URI, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	res, err := contextHTTPClient(ctx).Do(req)
+	if err != nil {
+		return errorsx.G11NError("unable to fetch the key set; err=%v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return errorsx.G11NError("unable to read the key set; err=%v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return errorsx.G11NError("unable to fetch the key set; status=%d, body=%s", res.StatusCode, string(body))
+	}
+
+	keys := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(body, keys); err != nil {
+		return errorsx.G11NError("unable to parse the key set; err=%v", err)
+	}
+
+	k.keys = keys
+	k.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+const (
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// JWTBearerAssertion contains the assertion presented using the JWT bearer grant, as described
+// in RFC 7523. Either an externally minted Assertion is provided, or the assertion is signed
+// using the SigningKey.
+type JWTBearerAssertion struct {
+	// Assertion optionally contains a JWT minted by a trusted issuer, such as the identity
+	// provider of the workload. When set, the other fields are ignored.
+	Assertion string
+
+	// SigningKey contains the JSONWebKey representation of the private key used to sign
+	// the assertion. The KeyID and Algorithm are expected to be populated.
+	SigningKey *jose.JSONWebKey
+
+	// Issuer optionally sets the iss claim. By default, this is set to the client_id.
+	Issuer string
+
+	// Subject sets the sub claim, which identifies the user or workload that the token
+	// is requested for. This is required when signing the assertion.
+	Subject string
+
+	// Audiences optionally sets the aud claim. By default, this is set to the issuer and
+	// the token endpoint of the tenant.
+	Audiences []string
+
+	// Claims optionally contains additional claims to add to the assertion.
+	Claims map[string]any
+
+	// Expires optionally specifies how long the assertion is valid for. By default, this is
+	// set to 5 mins.
+	Expires time.Duration
+}
+
+// TokenWithJWTBearer exchanges the JWT assertion for an access token using the JWT bearer
+// grant, as described in RFC 7523. The client is authenticated using the configured ClientAuth.
+func (c *Client) TokenWithJWTBearer(ctx context.Context, assertion *JWTBearerAssertion, parameters url.Values) (*TokenResponse, error) {
+	if assertion == nil {
+		return nil, errorsx.G11NError("'assertion' is required.")
+	}
+
+	token := assertion.Assertion
+	if token == "" {
+		var err error
+		if token, err = c.signJWTBearerAssertion(ctx, assertion); err != nil {
+			return nil, err
+		}
+	}
+
+	params := url.Values{}
+	if len(c.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	for k := range parameters {
+		params.Set(k, parameters.Get(k))
+	}
+
+	params.Set("grant_type", jwtBearerGrantType)
+	params.Set("assertion", token)
+
+	return c.tokenRequest(ctx, params)
+}
+
+func (c *Client) signJWTBearerAssertion(ctx context.Context, assertion *JWTBearerAssertion) (string, error) {
+	if assertion.Subject == "" {
+		return "", errorsx.G11NError("'subject' is required.")
+	}
+
+	issuer := assertion.Issuer
+	if issuer == "" {
+		params, err := c.ClientAuth.GetParameters()
+		if err != nil {
+			return "", err
+		}
+
+		issuer = params.Get("client_id")
+	}
+
+	audiences := assertion.Audiences
+	if len(audiences) == 0 {
+		tokenURL, err := c.endpoint(ctx, tokenEndpoint)
+		if err != nil {
+			return "", err
+		}
+
+		serverIssuer := c.issuer()
+		if c.Discovery != nil {
+			config, err := c.Discovery.Configuration(ctx)
+			if err != nil {
+				return "", err
+			}
+
+			serverIssuer = config.Issuer
+		}
+
+		audiences = []string{serverIssuer, tokenURL}
+	}
+
+	expires := assertion.Expires
+	if expires == 0 {
+		expires = 5 * time.Minute
+	}
+
+	claims := assertionClaims(issuer, assertion.Subject, audiences, expires)
+	for k, v := range assertion.Claims {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+
+	return signJWT(assertion.SigningKey, "JWT", claims)
+}
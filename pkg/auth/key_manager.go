@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+const (
+	// DefaultKeyRotationInterval is how long a signing key is active before it is rotated.
+	DefaultKeyRotationInterval = 30 * 24 * time.Hour
+
+	// DefaultKeyRotationOverlap is how long a retired key remains published after rotation,
+	// so assertions signed just before the rotation can still be verified.
+	DefaultKeyRotationOverlap = 24 * time.Hour
+)
+
+// SigningKeySource provides the current private key used to sign client assertions.
+type SigningKeySource interface {
+	// SigningKey returns the current private key. The KeyID and Algorithm are expected to be
+	// populated.
+	SigningKey() (*jose.JSONWebKey, error)
+}
+
+// KeyManager holds the private keys used by PrivateKeyJWT and publishes the public keys as a
+// JSON Web Key Set, so the client can be configured with a jwkUri rather than a fixed key.
+//
+// It holds an active key, used for signing, and the next key, which is published ahead of
+// time so the authorization server has fetched it before it becomes active. On rotation, the
+// next key becomes active, a new next key is generated and the previous key remains published
+// for the Overlap duration. It is safe for concurrent use.
+type KeyManager struct {
+	// RotationInterval specifies how long a key is active before Run rotates it. By default,
+	// this is set to DefaultKeyRotationInterval.
+	RotationInterval time.Duration
+
+	// Overlap specifies how long a retired key remains published. By default, this is set to
+	// DefaultKeyRotationOverlap.
+	Overlap time.Duration
+
+	// GenerateKey optionally generates new keys. By default, 2048-bit RSA keys using RS256
+	// are generated. Set it using KeyManagerOptions so it is also used for the initial keys.
+	GenerateKey func() (*jose.JSONWebKey, error)
+
+	// OnRotate is optionally called with the new keys after each rotation, such as to persist
+	// them for the next run of the application.
+	OnRotate func(active *jose.JSONWebKey, next *jose.JSONWebKey, rotatedAt time.Time) error
+
+	mu        sync.RWMutex
+	active    *jose.JSONWebKey
+	next      *jose.JSONWebKey
+	retired   []retiredKey
+	rotatedAt time.Time
+}
+
+// retiredKey is a previously active key that is still published.
+type retiredKey struct {
+	key   *jose.JSONWebKey
+	until time.Time
+}
+
+// KeyManagerOptions configures a KeyManager created using NewKeyManager.
+type KeyManagerOptions struct {
+	// RotationInterval specifies how long a key is active before Run rotates it. By default,
+	// this is set to DefaultKeyRotationInterval.
+	RotationInterval time.Duration
+
+	// Overlap specifies how long a retired key remains published. By default, this is set to
+	// DefaultKeyRotationOverlap.
+	Overlap time.Duration
+
+	// GenerateKey optionally generates the keys, including the initial keys that are not
+	// provided. By default, 2048-bit RSA keys using RS256 are generated.
+	GenerateKey func() (*jose.JSONWebKey, error)
+
+	// RotatedAt is the time the active key became active, such as persisted by a previous run
+	// of the application, so the rotation schedule is kept across restarts. By default, this
+	// is set to the current time.
+	RotatedAt time.Time
+
+	// OnRotate is optionally called with the new keys after each rotation, such as to persist
+	// them for the next run of the application.
+	OnRotate func(active *jose.JSONWebKey, next *jose.JSONWebKey, rotatedAt time.Time) error
+}
+
+// NewKeyManager returns a KeyManager that starts with the active and next keys, such as keys
+// persisted by a previous run of the application. Either key may be nil, in which case a new
+// key is generated. Keys without a KeyID are assigned their RFC 7638 thumbprint. The opts may
+// be nil to use the defaults.
+func NewKeyManager(active *jose.JSONWebKey, next *jose.JSONWebKey, opts *KeyManagerOptions) (*KeyManager, error) {
+	if opts == nil {
+		opts = &KeyManagerOptions{}
+	}
+
+	m := &KeyManager{
+		RotationInterval: opts.RotationInterval,
+		Overlap:          opts.Overlap,
+		GenerateKey:      opts.GenerateKey,
+		OnRotate:         opts.OnRotate,
+		rotatedAt:        opts.RotatedAt,
+	}
+
+	if m.RotationInterval == 0 {
+		m.RotationInterval = DefaultKeyRotationInterval
+	}
+
+	if m.Overlap == 0 {
+		m.Overlap = DefaultKeyRotationOverlap
+	}
+
+	if m.rotatedAt.IsZero() {
+		m.rotatedAt = time.Now()
+	}
+
+	var err error
+	if m.active, err = m.prepareKey(active); err != nil {
+		return nil, err
+	}
+
+	if m.next, err = m.prepareKey(next); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SigningKey returns the active key. It implements SigningKeySource.
+func (m *KeyManager) SigningKey() (*jose.JSONWebKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.active, nil
+}
+
+// NextKey returns the key that becomes active on the next rotation.
+func (m *KeyManager) NextKey() *jose.JSONWebKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.next
+}
+
+// RotatedAt returns the time the active key became active.
+func (m *KeyManager) RotatedAt() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.rotatedAt
+}
+
+// Rotate makes the next key active and generates a new next key. The previously active key
+// remains published for the Overlap duration. If OnRotate is set, it is called with the new
+// keys and its error is returned; the keys are rotated regardless.
+func (m *KeyManager) Rotate() error {
+	newNext, err := m.prepareKey(nil)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	overlap := m.Overlap
+	if overlap == 0 {
+		overlap = DefaultKeyRotationOverlap
+	}
+
+	now := time.Now()
+	m.retired = append(m.retired, retiredKey{key: m.active, until: now.Add(overlap)})
+	m.active = m.next
+	m.next = newNext
+	m.rotatedAt = now
+	active, onRotate := m.active, m.OnRotate
+	m.mu.Unlock()
+
+	// the hook is called without the lock held so it can use the KeyManager
+	if onRotate != nil {
+		if err := onRotate(active, newNext, now); err != nil {
+			return errorsx.G11NError("unable to save the rotated keys; err=%v", err)
+		}
+	}
+
+	return nil
+}
+
+// JWKS returns the public keys that are published: the active key, the next key and the
+// retired keys that are still within the overlap window.
+func (m *KeyManager) JWKS() *jose.JSONWebKeySet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// drop the keys whose overlap window has passed
+	now := time.Now()
+	retired := m.retired[:0]
+	for _, r := range m.retired {
+		if now.Before(r.until) {
+			retired = append(retired, r)
+		}
+	}
+	m.retired = retired
+
+	jwks := &jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{m.active.Public(), m.next.Public()},
+	}
+
+	for _, r := range m.retired {
+		jwks.Keys = append(jwks.Keys, r.key.Public())
+	}
+
+	return jwks
+}
+
+// ServeHTTP serves the JSON Web Key Set, so the URL of the handler can be configured as the
+// jwkUri of the client.
+func (m *KeyManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		_ = json.NewEncoder(w).Encode(m.JWKS())
+	}
+}
+
+// Run rotates the keys every RotationInterval until the context is done, which is returned as
+// the error. If the active key has been active for longer than RotationInterval, such as after
+// a restart, it is rotated immediately. It returns early if a new key cannot be generated or
+// OnRotate fails.
+func (m *KeyManager) Run(ctx context.Context) error {
+	for {
+		m.mu.RLock()
+		interval := m.RotationInterval
+		if interval == 0 {
+			interval = DefaultKeyRotationInterval
+		}
+
+		wait := time.Until(m.rotatedAt.Add(interval))
+		m.mu.RUnlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if err := m.Rotate(); err != nil {
+			return err
+		}
+	}
+}
+
+// prepareKey validates the key, or generates one if it is nil, and assigns the KeyID.
+func (m *KeyManager) prepareKey(key *jose.JSONWebKey) (*jose.JSONWebKey, error) {
+	if key == nil {
+		generate := m.GenerateKey
+		if generate == nil {
+			generate = generateRSAKey
+		}
+
+		var err error
+		if key, err = generate(); err != nil {
+			return nil, errorsx.G11NError("unable to generate a key; err=%v", err)
+		}
+	}
+
+	if key.IsPublic() || key.Algorithm == "" {
+		return nil, errorsx.G11NError("the key must be a private key with the 'alg' populated")
+	}
+
+	copied := *key
+	if copied.KeyID == "" {
+		thumbprint, err := copied.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, errorsx.G11NError("unable to compute the key thumbprint; err=%v", err)
+		}
+
+		copied.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	}
+
+	if copied.Use == "" {
+		copied.Use = "sig"
+	}
+
+	return &copied, nil
+}
+
+func generateRSAKey() (*jose.JSONWebKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jose.JSONWebKey{Key: key, Algorithm: string(jose.RS256)}, nil
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+const (
+	// BackchannelLogoutEvent is the member of the events claim that identifies a logout token.
+	BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	// DefaultLogoutTokenMaxAge is how long after it is issued a logout token without an exp
+	// claim is accepted, and remembered to detect replays.
+	DefaultLogoutTokenMaxAge = 2 * time.Minute
+)
+
+// LogoutRequest contains the parameters of an RP-initiated logout request, as described in
+// OpenID Connect RP-Initiated Logout 1.0.
+type LogoutRequest struct {
+	// IDTokenHint is the ID token issued to the user whose session is ended. It is recommended.
+	IDTokenHint string
+
+	// PostLogoutRedirectURI optionally specifies where the user is redirected after the logout.
+	// It must be registered for the application.
+	PostLogoutRedirectURI string
+
+	// State optionally contains an opaque value returned to the PostLogoutRedirectURI.
+	State string
+
+	// LogoutHint optionally identifies the user to log out.
+	LogoutHint string
+}
+
+// LogoutURL returns the URL of the end_session_endpoint that logs the user out of the
+// authorization server. The client_id is included so the PostLogoutRedirectURI can be
+// validated even without an IDTokenHint.
+func (c *Client) LogoutURL(ctx context.Context, request *LogoutRequest) (string, error) {
+	if request == nil {
+		request = &LogoutRequest{}
+	}
+
+	logoutURL, err := c.endpoint(ctx, endSessionEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	clientParams, err := c.ClientAuth.GetParameters()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"client_id": {clientParams.Get("client_id")},
+	}
+
+	if request.IDTokenHint != "" {
+		params.Set("id_token_hint", request.IDTokenHint)
+	}
+
+	if request.PostLogoutRedirectURI != "" {
+		params.Set("post_logout_redirect_uri", request.PostLogoutRedirectURI)
+	}
+
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+
+	if request.LogoutHint != "" {
+		params.Set("logout_hint", request.LogoutHint)
+	}
+
+	return buildURL(logoutURL, params), nil
+}
+
+// LogoutTokenClaims contains the claims of a back-channel logout token.
+type LogoutTokenClaims struct {
+	jwt.Claims
+
+	// SessionID is the sid claim that identifies the session at the OP.
+	SessionID string `json:"sid,omitempty"`
+
+	// Events contains the events claim.
+	Events map[string]any `json:"events"`
+
+	// Raw contains all the claims in the logout token, including those that are not well known.
+	Raw typesx.Map `json:"-"`
+}
+
+// BackchannelLogoutHandler receives logout tokens sent by the authorization server, as
+// described in OpenID Connect Back-Channel Logout 1.0. Each validated token is passed to
+// OnLogout so the application can end the local sessions of the user or OP session.
+type BackchannelLogoutHandler struct {
+	// Verifier provides the discovery document, keys, client ID and clock skew used to
+	// validate logout tokens.
+	Verifier *IDTokenVerifier
+
+	// OnLogout ends the local sessions identified by the sub and sid claims. If it returns
+	// an error, the authorization server is told that the logout failed.
+	OnLogout func(ctx context.Context, claims *LogoutTokenClaims) error
+
+	replay replayCache
+}
+
+// NewBackchannelLogoutHandler returns a BackchannelLogoutHandler that validates logout tokens
+// issued to the client of the verifier.
+func NewBackchannelLogoutHandler(verifier *IDTokenVerifier, onLogout func(ctx context.Context, claims *LogoutTokenClaims) error) *BackchannelLogoutHandler {
+	return &BackchannelLogoutHandler{
+		Verifier: verifier,
+		OnLogout: onLogout,
+	}
+}
+
+func (h *BackchannelLogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, expiry, err := h.verifyLogoutToken(r.Context(), r.PostFormValue("logout_token"))
+	if err != nil {
+		writeErrorResponse(w, &OAuthError{Code: "invalid_request", Description: err.Error(), StatusCode: http.StatusBadRequest})
+		return
+	}
+
+	if h.OnLogout != nil {
+		if err := h.OnLogout(r.Context(), claims); err != nil {
+			writeErrorResponse(w, &OAuthError{Code: "logout_failed", StatusCode: http.StatusBadRequest})
+			return
+		}
+	}
+
+	// the token is only recorded once the sessions have ended, so the authorization server
+	// can deliver it again after a failed logout
+	_ = h.replay.seen(logoutTokenID(claims), expiry)
+	w.WriteHeader(http.StatusOK)
+}
+
+// VerifyLogoutToken validates the signature of the logout token and the iss, aud, iat, exp,
+// jti, events, sub and sid claims, and rejects tokens that contain a nonce or are replayed.
+// The jti of the token is recorded to detect replays.
+func (h *BackchannelLogoutHandler) VerifyLogoutToken(ctx context.Context, rawLogoutToken string) (*LogoutTokenClaims, error) {
+	claims, expiry, err := h.verifyLogoutToken(ctx, rawLogoutToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.replay.seen(logoutTokenID(claims), expiry) {
+		return nil, errorsx.G11NError("the logout token has already been used")
+	}
+
+	return claims, nil
+}
+
+// verifyLogoutToken validates the logout token without recording its jti, and returns the
+// claims and the time until which the jti must be remembered.
+func (h *BackchannelLogoutHandler) verifyLogoutToken(ctx context.Context, rawLogoutToken string) (*LogoutTokenClaims, time.Time, error) {
+	if rawLogoutToken == "" {
+		return nil, time.Time{}, errorsx.G11NError("'logout_token' is required.")
+	}
+
+	v := h.Verifier
+	config, err := v.Discovery.Configuration(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	keySet, err := remoteKeySet(v.KeySet, config.JSONWebKeySetURI)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	claims := &LogoutTokenClaims{}
+	if _, err := verifyJWT(ctx, keySet, rawLogoutToken, config.IDTokenSigningAlgValuesSupported, claims, &claims.Raw); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if claims.IssuedAt == nil || claims.ID == "" {
+		return nil, time.Time{}, errorsx.G11NError("the logout token must contain 'iat' and 'jti'")
+	}
+
+	if err := claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:      config.Issuer,
+		AnyAudience: jwt.Audience{v.ClientID},
+	}, v.clockSkew()); err != nil {
+		return nil, time.Time{}, errorsx.G11NError("the logout token is invalid; err=%v", err)
+	}
+
+	expiry := claims.IssuedAt.Time().Add(DefaultLogoutTokenMaxAge)
+	if claims.Expiry != nil {
+		expiry = claims.Expiry.Time()
+	} else if time.Now().After(expiry.Add(v.clockSkew())) {
+		return nil, time.Time{}, errorsx.G11NError("the logout token is too old")
+	}
+
+	if _, ok := claims.Events[BackchannelLogoutEvent].(map[string]any); !ok {
+		return nil, time.Time{}, errorsx.G11NError("the logout token 'events' does not contain the back-channel logout event")
+	}
+
+	if claims.Subject == "" && claims.SessionID == "" {
+		return nil, time.Time{}, errorsx.G11NError("the logout token must contain 'sub' or 'sid'")
+	}
+
+	if _, ok := claims.Raw["nonce"]; ok {
+		return nil, time.Time{}, errorsx.G11NError("the logout token must not contain 'nonce'")
+	}
+
+	if h.replay.has(logoutTokenID(claims)) {
+		return nil, time.Time{}, errorsx.G11NError("the logout token has already been used")
+	}
+
+	return claims, expiry.Add(v.clockSkew()), nil
+}
+
+// logoutTokenID identifies the logout token in the replay cache.
+func logoutTokenID(claims *LogoutTokenClaims) string {
+	return claims.Issuer + "|" + claims.ID
+}
+
+// writeErrorResponse writes the error as a JSON error response.
+func writeErrorResponse(w http.ResponseWriter, oauthErr *OAuthError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(oauthErr.StatusCode)
+	_ = json.NewEncoder(w).Encode(oauthErr)
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+const (
+	// DefaultLoopbackCallbackPath is the path of the redirect URI served by the loopback listener.
+	DefaultLoopbackCallbackPath = "/callback"
+
+	defaultLoopbackSuccessPage = `<!DOCTYPE html><html><head><title>Signed in</title></head><body><p>You are signed in. You can close this window and return to the application.</p></body></html>`
+	defaultLoopbackFailurePage = `<!DOCTYPE html><html><head><title>Sign in failed</title></head><body><p>Sign in failed: %s</p></body></html>`
+)
+
+// LoopbackOptions configures the loopback listener used by TokenWithLoopbackRedirect.
+type LoopbackOptions struct {
+	// Port optionally specifies the port to listen on. By default, an ephemeral port is used.
+	// The redirect URI registered for the application is expected to allow any loopback port,
+	// as described in RFC 8252.
+	Port int
+
+	// CallbackPath optionally specifies the path of the redirect URI. By default, this is set
+	// to DefaultLoopbackCallbackPath.
+	CallbackPath string
+
+	// OpenURL optionally opens the authorization URL. By default, the system browser is opened.
+	// If the URL cannot be opened, it is printed to Output for the user to open.
+	OpenURL func(authCodeURL string) error
+
+	// Output optionally receives the instructions printed for the user. By default, this is
+	// set to os.Stderr.
+	Output io.Writer
+
+	// SuccessPage optionally contains the HTML page shown once the user is signed in.
+	SuccessPage string
+
+	// FailurePage optionally contains the HTML page shown when the flow fails. Each %s in the
+	// page is replaced with the HTML-escaped error; the page is not otherwise formatted.
+	FailurePage string
+
+	// PushedAuthorizationRequest optionally starts the flow using a Pushed Authorization
+	// Request instead of passing the parameters in the authorization URL.
+	PushedAuthorizationRequest bool
+}
+
+// loopbackResult is the outcome of the callback served by the loopback listener.
+type loopbackResult struct {
+	token *TokenResponse
+	err   error
+}
+
+// TokenWithLoopbackRedirect completes the browser flow for native applications, such as CLIs,
+// using a loopback redirect URI, as described in RFC 8252. It listens on 127.0.0.1, uses
+// the listener address as the RedirectURL, opens the authorization URL, and exchanges the
+// authorization code received on the callback using the PKCE verifier. The state is validated
+// before the exchange.
+//
+// The RedirectURL of the client is not modified. The flow is bounded by the context, which is
+// expected to carry a deadline.
+func (c *Client) TokenWithLoopbackRedirect(ctx context.Context, opts *LoopbackOptions, parameters url.Values) (*TokenResponse, error) {
+	if opts == nil {
+		opts = &LoopbackOptions{}
+	}
+
+	callbackPath := opts.CallbackPath
+	if callbackPath == "" {
+		callbackPath = DefaultLoopbackCallbackPath
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", opts.Port))
+	if err != nil {
+		return nil, errorsx.G11NError("unable to start the loopback listener; err=%v", err)
+	}
+	defer ln.Close()
+
+	// the flow uses a copy of the client so the RedirectURL matches the listener
+	lc := *c
+	lc.RedirectURL = fmt.Sprintf("http://%s%s", ln.Addr().String(), callbackPath)
+
+	var authResponse *AuthorizeResponse
+	if opts.PushedAuthorizationRequest {
+		authResponse, err = lc.AuthorizeWithPushedAuthorizationRequest(ctx, parameters)
+	} else {
+		authResponse, err = lc.AuthorizeWithBrowserFlow(ctx, parameters)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan loopbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != authResponse.State {
+			// ignore requests that are not the response to this flow
+			http.Error(w, "the state does not match", http.StatusBadRequest)
+			return
+		}
+
+		t, err := lc.TokenWithAuthCode(ctx, authResponse, query)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, loopbackFailurePage(opts.FailurePage, err))
+		} else {
+			_, _ = io.WriteString(w, valueOrDefault(opts.SuccessPage, defaultLoopbackSuccessPage))
+		}
+
+		select {
+		case results <- loopbackResult{token: t, err: err}:
+		default:
+		}
+	})
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case results <- loopbackResult{err: errorsx.G11NError("the loopback listener failed; err=%v", err)}:
+			default:
+			}
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	openURL := opts.OpenURL
+	if openURL == nil {
+		openURL = openBrowser
+	}
+
+	if err := openURL(authResponse.AuthCodeURL); err != nil {
+		output := opts.Output
+		if output == nil {
+			output = os.Stderr
+		}
+
+		fmt.Fprintf(output, "Open the following URL in your browser to sign in:\n\n%s\n\n", authResponse.AuthCodeURL)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		return result.token, result.err
+	}
+}
+
+func loopbackFailurePage(page string, err error) string {
+	page = valueOrDefault(page, defaultLoopbackFailurePage)
+	return strings.ReplaceAll(page, "%s", html.EscapeString(err.Error()))
+}
+
+func valueOrDefault(v string, def string) string {
+	if v == "" {
+		return def
+	}
+
+	return v
+}
+
+// openBrowser opens the URL in the system browser.
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// reap the process once the browser, or the launcher, exits
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
@@ -0,0 +1,119 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type MTLSTestSuite struct {
+	suite.Suite
+
+	ctx    context.Context
+	server *httptest.Server
+	client *auth.Client
+	issuer string
+	paths  []string
+}
+
+func newClientCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "unable to generate a key")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "clientID"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err, "unable to create the certificate")
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (s *MTLSTestSuite) SetupTest() {
+	s.paths = nil
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.paths = append(s.paths, r.URL.Path)
+		if r.URL.Path == "/oauth2"+auth.DiscoveryEndpoint {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"issuer":                 s.issuer,
+				"token_endpoint":         s.issuer + "/token",
+				"introspection_endpoint": s.issuer + "/introspect",
+				"mtls_endpoint_aliases": map[string]any{
+					"token_endpoint": s.server.URL + "/mtls/token",
+				},
+			})
+			return
+		}
+
+		require.NotEmpty(s.T(), r.TLS.PeerCertificates, "the client certificate must be presented")
+		require.Equal(s.T(), "clientID", r.PostFormValue("client_id"))
+		require.Empty(s.T(), r.PostFormValue("client_secret"))
+
+		switch r.URL.Path {
+		case "/mtls/token":
+			writeJSON(w, http.StatusOK, map[string]any{
+				"access_token": "access",
+				"token_type":   "Bearer",
+				"expires_in":   7200,
+			})
+		case "/oauth2/introspect":
+			writeJSON(w, http.StatusOK, map[string]any{"active": true})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	s.server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	s.server.StartTLS()
+
+	tenant := strings.TrimPrefix(s.server.URL, "https://")
+	s.issuer = s.server.URL + "/oauth2"
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+	s.client = &auth.Client{
+		Tenant: tenant,
+		ClientAuth: &auth.TLSClientAuth{
+			ClientID:    "clientID",
+			Certificate: newClientCertificate(s.T()),
+		},
+		Discovery: auth.NewDiscovery(tenant),
+	}
+}
+
+func (s *MTLSTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *MTLSTestSuite) TestEndpointAliases() {
+	t, err := s.client.TokenWithAPIClient(s.ctx, nil)
+	require.NoError(s.T(), err, "unable to get a token")
+	require.Equal(s.T(), "access", t.AccessToken)
+
+	// the introspection endpoint has no alias
+	res, err := s.client.IntrospectToken(s.ctx, t.AccessToken, auth.TokenTypeHintAccessToken)
+	require.NoError(s.T(), err, "unable to introspect the token")
+	require.True(s.T(), res.Active)
+
+	require.Equal(s.T(), []string{"/oauth2" + auth.DiscoveryEndpoint, "/mtls/token", "/oauth2/introspect"}, s.paths)
+}
+
+func TestMTLSTestSuite(t *testing.T) {
+	suite.Run(t, new(MTLSTestSuite))
+}
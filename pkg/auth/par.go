@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+// pushedAuthorizationResponse is the response of the PAR endpoint described in RFC 9126.
+type pushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+// AuthorizeWithPushedAuthorizationRequest starts the browser flow using a Pushed Authorization
+// Request (PAR), as described in RFC 9126. The authorization parameters, including the PKCE
+// challenge, are posted to the PAR endpoint using the configured ClientAuth, and the returned
+// AuthCodeURL only contains the client_id and request_uri parameters.
+//
+// The request_uri can only be used until RequestURIExpiry in the AuthorizeResponse. The flow is
+// completed using TokenWithAuthCode.
+func (c *Client) AuthorizeWithPushedAuthorizationRequest(ctx context.Context, parameters url.Values) (*AuthorizeResponse, error) {
+	params, authResponse, err := c.authorizationParameters(ctx, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := c.endpoint(ctx, authorizationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	res, body, err := c.postForm(ctx, pushedAuthorizationRequestEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return nil, newResponseError(res, body)
+	}
+
+	parResponse := &pushedAuthorizationResponse{}
+	if err := json.Unmarshal(body, parResponse); err != nil {
+		return nil, errorsx.G11NError("unable to parse the pushed authorization response; err=%v", err)
+	}
+
+	if parResponse.RequestURI == "" {
+		return nil, errorsx.G11NError("the pushed authorization response does not contain a 'request_uri'")
+	}
+
+	authResponse.RequestURI = parResponse.RequestURI
+	authResponse.RequestURIExpiry = time.Now().Add(time.Duration(parResponse.ExpiresIn) * time.Second)
+	authResponse.AuthCodeURL = buildURL(authURL, url.Values{
+		"client_id":   {params.Get("client_id")},
+		"request_uri": {parResponse.RequestURI},
+	})
+
+	return authResponse, nil
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+// passwordErrorReasons maps the error codes, and the phrases found in the descriptions of
+// invalid_grant errors, to the reason they identify. The codes are those returned by
+// authorization servers in addition to the codes of the reasons themselves, such as
+// interaction_required from OpenID Connect and too_many_attempts from Auth0.
+var passwordErrorReasons = []struct {
+	err      *OAuthError
+	codes    []string
+	keywords []string
+}{
+	{ErrAccountLocked, []string{"too_many_attempts"}, []string{"locked", "disabled"}},
+	{ErrPasswordExpired, nil, []string{"password expired", "password has expired", "password must be changed", "change the password"}},
+	{ErrMFARequired, []string{"interaction_required"}, []string{"mfa", "multi-factor", "multifactor", "second factor", "2fa"}},
+}
+
+// TokenWithPassword gets a token for the user using the resource owner password credentials
+// grant, authenticating the client with the configured ClientAuth. The Scopes of the client
+// are requested unless the parameters contain a scope.
+//
+// This grant exposes the password of the user to the client and cannot perform multi-factor
+// authentication, so it is only intended for legacy tools, such as batch jobs and test
+// harnesses, that are being migrated to other flows. The grant must be enabled for the client.
+//
+// If the user account is locked, the password has expired or multi-factor authentication is
+// required, the error matches ErrAccountLocked, ErrPasswordExpired or ErrMFARequired using
+// errors.Is. It also matches the error code returned by the authorization server, such as
+// ErrInvalidGrant.
+func (c *Client) TokenWithPassword(ctx context.Context, username string, password string, parameters url.Values) (*TokenResponse, error) {
+	if username == "" {
+		return nil, errorsx.G11NError("'username' is required.")
+	}
+
+	if password == "" {
+		return nil, errorsx.G11NError("'password' is required.")
+	}
+
+	params := url.Values{}
+	if len(c.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	for k := range parameters {
+		params.Set(k, parameters.Get(k))
+	}
+
+	params.Set("grant_type", "password")
+	params.Set("username", username)
+	params.Set("password", password)
+
+	t, err := c.tokenRequest(ctx, params)
+	if err != nil {
+		return nil, newPasswordError(err)
+	}
+
+	return t, nil
+}
+
+// passwordError is an error returned by the password grant that identifies why the user
+// cannot authenticate, in addition to the error returned by the authorization server.
+type passwordError struct {
+	*OAuthError
+
+	reason *OAuthError
+}
+
+func (e *passwordError) Is(target error) bool {
+	return e.reason.Is(target) || e.OAuthError.Is(target)
+}
+
+func (e *passwordError) Unwrap() error {
+	return e.OAuthError
+}
+
+// newPasswordError classifies the error using the error code, or the error description when the
+// authorization server returns invalid_grant. Other errors, such as invalid_client, are returned
+// as is.
+func newPasswordError(err error) error {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		return err
+	}
+
+	for _, r := range passwordErrorReasons {
+		if oauthErr.Code == r.err.Code {
+			return err
+		}
+
+		for _, code := range r.codes {
+			if oauthErr.Code == code {
+				return &passwordError{OAuthError: oauthErr, reason: r.err}
+			}
+		}
+	}
+
+	if oauthErr.Code != ErrInvalidGrant.Code {
+		return err
+	}
+
+	description := strings.ToLower(oauthErr.Description)
+	for _, r := range passwordErrorReasons {
+		for _, keyword := range r.keywords {
+			if strings.Contains(description, keyword) {
+				return &passwordError{OAuthError: oauthErr, reason: r.err}
+			}
+		}
+	}
+
+	return err
+}
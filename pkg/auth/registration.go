@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+// ClientMetadata contains the metadata of a client registered using Dynamic Client
+// Registration, as described in RFC 7591 and OpenID Connect Dynamic Client Registration 1.0.
+type ClientMetadata struct {
+	// RedirectURIs contains the redirection URIs used in the authorization code flow.
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+
+	// TokenEndpointAuthMethod is the client authentication method, such as client_secret_basic.
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty"`
+
+	// TokenEndpointAuthSigningAlg is the algorithm used to sign client assertions.
+	TokenEndpointAuthSigningAlg string `json:"token_endpoint_auth_signing_alg,omitempty"`
+
+	// GrantTypes contains the grant types the client can use, such as authorization_code.
+	GrantTypes []string `json:"grant_types,omitempty"`
+
+	// ResponseTypes contains the response types the client can use, such as code.
+	ResponseTypes []string `json:"response_types,omitempty"`
+
+	// ClientName is the name of the client shown to users.
+	ClientName string `json:"client_name,omitempty"`
+
+	// ClientURI is the URL of the home page of the client.
+	ClientURI string `json:"client_uri,omitempty"`
+
+	// LogoURI is the URL of the logo of the client.
+	LogoURI string `json:"logo_uri,omitempty"`
+
+	// Scope is a space-delimited list of scopes the client can request.
+	Scope string `json:"scope,omitempty"`
+
+	// Contacts contains the email addresses of the people responsible for the client.
+	Contacts []string `json:"contacts,omitempty"`
+
+	// TOSURI is the URL of the terms of service of the client.
+	TOSURI string `json:"tos_uri,omitempty"`
+
+	// PolicyURI is the URL of the privacy policy of the client.
+	PolicyURI string `json:"policy_uri,omitempty"`
+
+	// JWKSURI is the URL of the JSON Web Key Set of the client.
+	JWKSURI string `json:"jwks_uri,omitempty"`
+
+	// JWKS contains the JSON Web Key Set of the client, when it is not published at JWKSURI.
+	JWKS *jose.JSONWebKeySet `json:"jwks,omitempty"`
+
+	// SoftwareID identifies the software of the client across instances.
+	SoftwareID string `json:"software_id,omitempty"`
+
+	// SoftwareVersion is the version of the software of the client.
+	SoftwareVersion string `json:"software_version,omitempty"`
+
+	// SoftwareStatement is a signed JWT asserting the metadata of the client.
+	SoftwareStatement string `json:"software_statement,omitempty"`
+
+	// PostLogoutRedirectURIs contains the URIs used after an RP-initiated logout.
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+
+	// BackchannelLogoutURI is the URL that receives back-channel logout tokens.
+	BackchannelLogoutURI string `json:"backchannel_logout_uri,omitempty"`
+
+	// IDTokenSignedResponseAlg is the algorithm used to sign ID tokens issued to the client.
+	IDTokenSignedResponseAlg string `json:"id_token_signed_response_alg,omitempty"`
+
+	// UserInfoSignedResponseAlg is the algorithm used to sign UserInfo responses to the client.
+	UserInfoSignedResponseAlg string `json:"userinfo_signed_response_alg,omitempty"`
+
+	// TLSClientAuthSubjectDN is the subject DN of the certificate used for tls_client_auth.
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty"`
+
+	// DPoPBoundAccessTokens specifies whether the access tokens issued to the client are
+	// always bound to a DPoP key.
+	DPoPBoundAccessTokens bool `json:"dpop_bound_access_tokens,omitempty"`
+
+	// Extra contains additional metadata, such as properties specific to the tenant.
+	Extra map[string]any `json:"-"`
+}
+
+// ClientRegistration is the response of the registration endpoint. It contains the metadata of
+// the registered client and the credentials used to manage the registration.
+type ClientRegistration struct {
+	ClientMetadata
+
+	// ClientID is the client_id issued to the client.
+	ClientID string `json:"client_id"`
+
+	// ClientSecret is the client_secret issued to the client, if any.
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// ClientIDIssuedAt is the time, in seconds since the epoch, the client_id was issued.
+	ClientIDIssuedAt int64 `json:"client_id_issued_at,omitempty"`
+
+	// ClientSecretExpiresAt is the time, in seconds since the epoch, the client_secret expires,
+	// or 0 if it does not expire.
+	ClientSecretExpiresAt int64 `json:"client_secret_expires_at,omitempty"`
+
+	// RegistrationAccessToken is the token used to read, update and delete the registration.
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+
+	// RegistrationClientURI is the URL used to read, update and delete the registration.
+	RegistrationClientURI string `json:"registration_client_uri,omitempty"`
+}
+
+// clientRegistrationFields contains the JSON property names of the well known fields of ClientRegistration.
+var clientRegistrationFields = jsonFieldNames(reflect.TypeOf(ClientRegistration{}))
+
+// RegisterClient registers a new client using the registration endpoint, as described in
+// RFC 7591. The initialAccessToken is optional and is required if the tenant restricts
+// registration. The Tenant and Discovery of the client are used to find the endpoint, and
+// ClientAuth is not needed.
+func (c *Client) RegisterClient(ctx context.Context, metadata *ClientMetadata, initialAccessToken string) (*ClientRegistration, error) {
+	if metadata == nil {
+		return nil, errorsx.G11NError("'metadata' is required.")
+	}
+
+	registrationURL, err := c.endpoint(ctx, registrationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.registrationRequest(ctx, http.MethodPost, registrationURL, initialAccessToken, metadata, http.StatusCreated)
+}
+
+// ReadClientRegistration returns the current registration of the client, as described in RFC 7592.
+// The registration_access_token and registration_client_uri are kept if they are not returned.
+func (c *Client) ReadClientRegistration(ctx context.Context, registration *ClientRegistration) (*ClientRegistration, error) {
+	if err := validateRegistration(registration); err != nil {
+		return nil, err
+	}
+
+	current, err := c.registrationRequest(ctx, http.MethodGet, registration.RegistrationClientURI, registration.RegistrationAccessToken, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	return current.withManagementCredentials(registration), nil
+}
+
+// UpdateClientRegistration replaces the metadata of the registered client, as described in
+// RFC 7592. Metadata that is omitted may be removed or reset to default values by the tenant.
+// The registration_access_token and registration_client_uri are kept if they are not returned.
+func (c *Client) UpdateClientRegistration(ctx context.Context, registration *ClientRegistration, metadata *ClientMetadata) (*ClientRegistration, error) {
+	if err := validateRegistration(registration); err != nil {
+		return nil, err
+	}
+
+	if metadata == nil {
+		return nil, errorsx.G11NError("'metadata' is required.")
+	}
+
+	// the update request must contain the client_id
+	body := &ClientRegistration{
+		ClientMetadata: *metadata,
+		ClientID:       registration.ClientID,
+	}
+
+	updated, err := c.registrationRequest(ctx, http.MethodPut, registration.RegistrationClientURI, registration.RegistrationAccessToken, body, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated.withManagementCredentials(registration), nil
+}
+
+// DeleteClientRegistration deletes the registered client, as described in RFC 7592.
+func (c *Client) DeleteClientRegistration(ctx context.Context, registration *ClientRegistration) error {
+	if err := validateRegistration(registration); err != nil {
+		return err
+	}
+
+	_, err := c.registrationRequest(ctx, http.MethodDelete, registration.RegistrationClientURI, registration.RegistrationAccessToken, nil, http.StatusNoContent)
+	return err
+}
+
+// NewClient returns a Client for the registered client, using the Tenant, Discovery and other
+// settings of the base client. The ClientAuth is chosen using the token_endpoint_auth_method.
+// For the private_key_jwt, tls_client_auth and self_signed_tls_client_auth methods, the key
+// or certificate is taken from the ClientAuth of the base client, which must use the same method.
+func (r *ClientRegistration) NewClient(base *Client) (*Client, error) {
+	c := *base
+	if len(r.RedirectURIs) > 0 {
+		c.RedirectURL = r.RedirectURIs[0]
+	}
+
+	if r.Scope != "" {
+		c.Scopes = strings.Fields(r.Scope)
+	}
+
+	if r.UserInfoSignedResponseAlg != "" {
+		c.UserInfoSignedResponseAlg = r.UserInfoSignedResponseAlg
+	}
+
+	method := r.TokenEndpointAuthMethod
+	if method == "" {
+		method = ClientAuthMethodClientSecretBasic
+	}
+
+	switch method {
+	case ClientAuthMethodClientSecretBasic:
+		c.ClientAuth = &ClientSecretBasic{ClientID: r.ClientID, ClientSecret: r.ClientSecret}
+	case ClientAuthMethodClientSecretPost, "none":
+		c.ClientAuth = &ClientSecretPost{ClientID: r.ClientID, ClientSecret: r.ClientSecret}
+	case ClientAuthMethodClientSecretJWT:
+		c.ClientAuth = &ClientSecretJWT{
+			Tenant:       base.Tenant,
+			ClientID:     r.ClientID,
+			ClientSecret: r.ClientSecret,
+			Algorithm:    jose.SignatureAlgorithm(r.TokenEndpointAuthSigningAlg),
+		}
+	default:
+		if clientAuthMethod(base.ClientAuth) != method {
+			return nil, errorsx.G11NError("the base client must be configured with the '%s' client authentication method", method)
+		}
+
+		switch ca := base.ClientAuth.(type) {
+		case *PrivateKeyJWT:
+			copied := *ca
+			copied.ClientID = r.ClientID
+			c.ClientAuth = &copied
+		case *TLSClientAuth:
+			copied := *ca
+			copied.ClientID = r.ClientID
+			c.ClientAuth = &copied
+		case *SelfSignedTLSClientAuth:
+			copied := *ca
+			copied.ClientID = r.ClientID
+			c.ClientAuth = &copied
+		}
+	}
+
+	return &c, nil
+}
+
+// withManagementCredentials keeps the registration_access_token and registration_client_uri of
+// the previous registration when they are not returned again, as RFC 7592 allows, so the
+// returned registration can still be used to manage the client.
+func (r *ClientRegistration) withManagementCredentials(previous *ClientRegistration) *ClientRegistration {
+	if r.RegistrationAccessToken == "" {
+		r.RegistrationAccessToken = previous.RegistrationAccessToken
+	}
+
+	if r.RegistrationClientURI == "" {
+		r.RegistrationClientURI = previous.RegistrationClientURI
+	}
+
+	return r
+}
+
+func validateRegistration(registration *ClientRegistration) error {
+	if registration == nil || registration.RegistrationClientURI == "" || registration.RegistrationAccessToken == "" {
+		return errorsx.G11NError("the registration must contain the 'registration_client_uri' and 'registration_access_token'")
+	}
+
+	return nil
+}
+
+// registrationRequest sends the metadata, if any, to the registration URL using the bearer token
+// and parses the registration in the response.
+func (c *Client) registrationRequest(ctx context.Context, method string, registrationURL string, token string, body any, expectedStatus int) (*ClientRegistration, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := marshalClientMetadata(body)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, registrationURL, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	hc, err := c.httpClient(ctx, registrationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, errorsx.G11NError("unable to read the response; err=%v", err)
+	}
+
+	if res.StatusCode != expectedStatus && !(expectedStatus == http.StatusCreated && res.StatusCode == http.StatusOK) {
+		return nil, newResponseError(res, resBody)
+	}
+
+	if method == http.MethodDelete {
+		return nil, nil
+	}
+
+	registration := &ClientRegistration{}
+	if err := json.Unmarshal(resBody, registration); err != nil {
+		return nil, errorsx.G11NError("unable to parse the client registration; err=%v", err)
+	}
+
+	if registration.Extra, err = extraFields(resBody, clientRegistrationFields); err != nil {
+		return nil, errorsx.G11NError("unable to parse the client registration; err=%v", err)
+	}
+
+	return registration, nil
+}
+
+// marshalClientMetadata encodes the metadata, or registration, including the Extra metadata.
+func marshalClientMetadata(v any) ([]byte, error) {
+	var extra map[string]any
+	switch m := v.(type) {
+	case *ClientMetadata:
+		extra = m.Extra
+	case *ClientRegistration:
+		extra = m.Extra
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeExtraFields(payload, extra)
+}
@@ -0,0 +1,426 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	contextx "github.com/ibm-verify/verify-sdk-go/pkg/core/context"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+const (
+	// ResponseModeFormPost requests the authorization response to be posted to the redirect URI.
+	// The login state cookie is then sent with SameSite=None so it is included in the
+	// cross-site POST.
+	ResponseModeFormPost = "form_post"
+
+	// DefaultSessionMaxAge is how long an authenticated session is kept by default.
+	DefaultSessionMaxAge = 8 * time.Hour
+
+	// DefaultLoginStateMaxAge is how long the state of a login in progress is kept by default.
+	DefaultLoginStateMaxAge = 10 * time.Minute
+
+	defaultSessionName = "verify_session"
+)
+
+// Session is the authenticated session of a user, established by RelyingParty.CallbackHandler.
+type Session struct {
+	// Subject is the sub claim of the ID token.
+	Subject string `json:"sub"`
+
+	// SessionID is the sid claim of the ID token, which identifies the session at the
+	// authorization server.
+	SessionID string `json:"sid,omitempty"`
+
+	// Claims contains all the claims of the validated ID token. It is not stored with the
+	// session, but read from the ID token in the TokenResponse when the session is loaded.
+	Claims typesx.Map `json:"-"`
+
+	// TokenResponse contains the tokens issued for the session.
+	TokenResponse *TokenResponse `json:"token"`
+
+	// Expiry is the time after which the session is no longer valid.
+	Expiry time.Time `json:"expiry"`
+}
+
+// loginState is the state of a login in progress, kept until the callback.
+type loginState struct {
+	State            string `json:"state"`
+	Nonce            string `json:"nonce"`
+	PKCECodeVerifier string `json:"verifier"`
+	ReturnTo         string `json:"return_to,omitempty"`
+}
+
+// RelyingParty provides the http.Handlers to sign users in to a web application using OpenID
+// Connect. The state, nonce and PKCE verifier of a login in progress, and the authenticated
+// Session, are kept in the Store.
+type RelyingParty struct {
+	// Client is the client used for the authorization code flow. The RedirectURL is expected
+	// to be the URL served by CallbackHandler.
+	Client *Client
+
+	// Verifier validates the ID token issued on the callback.
+	Verifier *IDTokenVerifier
+
+	// Store keeps the login state and the authenticated session.
+	Store SessionStore
+
+	// ResponseMode optionally requests a response mode, such as ResponseModeFormPost. By
+	// default, the authorization response is returned in the query of the redirect URI.
+	ResponseMode string
+
+	// Parameters optionally contains additional parameters for the authorization request.
+	Parameters url.Values
+
+	// LoginURL is the path served by LoginHandler. Middleware redirects to it when there is
+	// no session. By default, this is set to "/login".
+	LoginURL string
+
+	// AfterLoginURL is where the user is redirected after signing in, when the login did not
+	// start from a protected page. By default, this is set to "/".
+	AfterLoginURL string
+
+	// AfterLogoutURL is where the user is redirected after the session is removed. By
+	// default, this is set to "/".
+	AfterLogoutURL string
+
+	// PostLogoutRedirectURI optionally ends the session at the authorization server as well,
+	// using RP-initiated logout. The user is redirected to the end_session_endpoint, which
+	// redirects back to this URI once done. It must be registered for the application.
+	PostLogoutRedirectURI string
+
+	// SessionName optionally specifies the name of the session cookie.
+	SessionName string
+
+	// SessionMaxAge optionally specifies how long the session is kept. By default, this is
+	// set to DefaultSessionMaxAge.
+	SessionMaxAge time.Duration
+
+	// ErrorHandler optionally writes the response when the login fails. By default, a 400
+	// response is written without the details of the error.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewRelyingParty returns a RelyingParty for the client. The ID tokens are validated using the
+// Discovery of the client, or the discovery document of the tenant if none is configured.
+func NewRelyingParty(client *Client, store SessionStore) (*RelyingParty, error) {
+	params, err := client.ClientAuth.GetParameters()
+	if err != nil {
+		return nil, err
+	}
+
+	discovery := client.Discovery
+	if discovery == nil {
+		discovery = NewDiscovery(client.Tenant)
+	}
+
+	return &RelyingParty{
+		Client:   client,
+		Verifier: NewIDTokenVerifier(discovery, params.Get("client_id")),
+		Store:    store,
+	}, nil
+}
+
+// NewContextWithSession returns a context holding the authenticated session.
+func NewContextWithSession(parentContext context.Context, session *Session) context.Context {
+	return context.WithValue(parentContext, contextx.SessionCtxKey, session)
+}
+
+// GetSession returns the session loaded by RelyingParty.Middleware, or nil if there is none.
+func GetSession(ctx context.Context) *Session {
+	session, _ := ctx.Value(contextx.SessionCtxKey).(*Session)
+	return session
+}
+
+// LoginHandler starts the authorization code flow and redirects the user to the authorization
+// endpoint. A local path to return to after signing in can be passed in the return_to query
+// parameter.
+func (rp *RelyingParty) LoginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := url.Values{}
+		for k, v := range rp.Parameters {
+			params[k] = v
+		}
+
+		if rp.ResponseMode != "" {
+			params.Set("response_mode", rp.ResponseMode)
+		}
+
+		authResponse, err := rp.Client.AuthorizeWithBrowserFlow(r.Context(), params)
+		if err != nil {
+			rp.handleError(w, r, err)
+			return
+		}
+
+		state := &loginState{
+			State:            authResponse.State,
+			Nonce:            authResponse.Nonce,
+			PKCECodeVerifier: authResponse.PKCECodeVerifier,
+		}
+
+		if returnTo := r.URL.Query().Get("return_to"); isLocalPath(returnTo) {
+			state.ReturnTo = returnTo
+		}
+
+		opts := &SessionOptions{MaxAge: DefaultLoginStateMaxAge}
+		if rp.ResponseMode == ResponseModeFormPost {
+			opts.SameSite = http.SameSiteNoneMode
+		}
+
+		if err := rp.Store.Save(w, r, rp.loginStateName(state.State), state, opts); err != nil {
+			rp.handleError(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, authResponse.AuthCodeURL, http.StatusFound)
+	})
+}
+
+// CallbackHandler completes the authorization code flow. It accepts the authorization response
+// in the query or, for the form_post response mode, the form body. The state is validated, the
+// code is exchanged using the PKCE verifier, and the ID token is validated before the session
+// is saved.
+func (rp *RelyingParty) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbackParams := r.URL.Query()
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				rp.handleError(w, r, errorsx.G11NError("unable to parse the authorization response; err=%v", err))
+				return
+			}
+
+			callbackParams = r.PostForm
+		}
+
+		// the login state is kept per state value so logins started in parallel, such as
+		// in several tabs, do not replace each other
+		stateName := rp.loginStateName(callbackParams.Get("state"))
+		state := &loginState{}
+		found, err := rp.Store.Load(r, stateName, state)
+		if err != nil {
+			rp.handleError(w, r, err)
+			return
+		}
+
+		if !found {
+			rp.handleError(w, r, errorsx.G11NError("there is no login in progress"))
+			return
+		}
+
+		// the state can only be used once
+		_ = rp.Store.Delete(w, r, stateName)
+
+		authResponse := &AuthorizeResponse{
+			State:            state.State,
+			Nonce:            state.Nonce,
+			PKCECodeVerifier: state.PKCECodeVerifier,
+		}
+
+		tokenResponse, err := rp.Client.TokenWithAuthCode(r.Context(), authResponse, callbackParams)
+		if err != nil {
+			rp.handleError(w, r, err)
+			return
+		}
+
+		if tokenResponse.IDToken == "" {
+			rp.handleError(w, r, errorsx.G11NError("the token response does not contain an ID token"))
+			return
+		}
+
+		claims, err := rp.Verifier.Verify(r.Context(), tokenResponse.IDToken, &IDTokenVerifyOptions{
+			Nonce:       authResponse.Nonce,
+			AccessToken: tokenResponse.AccessToken,
+			Code:        callbackParams.Get("code"),
+		})
+		if err != nil {
+			rp.handleError(w, r, err)
+			return
+		}
+
+		maxAge := rp.sessionMaxAge()
+		session := &Session{
+			Subject:       claims.Subject,
+			SessionID:     claims.SessionID,
+			Claims:        claims.Raw,
+			TokenResponse: tokenResponse,
+			Expiry:        time.Now().Add(maxAge),
+		}
+
+		if err := rp.Store.Save(w, r, rp.sessionName(), session, &SessionOptions{MaxAge: maxAge}); err != nil {
+			rp.handleError(w, r, err)
+			return
+		}
+
+		returnTo := state.ReturnTo
+		if returnTo == "" {
+			returnTo = valueOrDefault(rp.AfterLoginURL, "/")
+		}
+
+		http.Redirect(w, r, returnTo, http.StatusFound)
+	})
+}
+
+// LogoutHandler removes the local session and redirects the user to AfterLogoutURL. If
+// PostLogoutRedirectURI is set, the user is redirected to the end_session_endpoint instead.
+func (rp *RelyingParty) LogoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := rp.Session(r)
+		_ = rp.Store.Delete(w, r, rp.sessionName())
+
+		if rp.PostLogoutRedirectURI == "" {
+			http.Redirect(w, r, valueOrDefault(rp.AfterLogoutURL, "/"), http.StatusFound)
+			return
+		}
+
+		request := &LogoutRequest{
+			PostLogoutRedirectURI: rp.PostLogoutRedirectURI,
+		}
+
+		if session != nil && session.TokenResponse != nil {
+			request.IDTokenHint = session.TokenResponse.IDToken
+		}
+
+		logoutURL, err := rp.Client.LogoutURL(r.Context(), request)
+		if err != nil {
+			rp.handleError(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, logoutURL, http.StatusFound)
+	})
+}
+
+// Middleware returns net/http middleware that requires an authenticated session. The session is
+// available to the next handler using GetSession. Requests without a session are redirected to
+// LoginURL if they are GET requests, and are rejected with a 401 response otherwise.
+func (rp *RelyingParty) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := rp.Session(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if session == nil {
+			if r.Method != http.MethodGet {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			loginURL := valueOrDefault(rp.LoginURL, "/login")
+			http.Redirect(w, r, buildURL(loginURL, url.Values{"return_to": {r.URL.RequestURI()}}), http.StatusFound)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContextWithSession(r.Context(), session)))
+	})
+}
+
+// Session returns the authenticated session of the request, or nil if there is none or it
+// has expired.
+func (rp *RelyingParty) Session(r *http.Request) (*Session, error) {
+	session := &Session{}
+	found, err := rp.Store.Load(r, rp.sessionName(), session)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	if time.Now().After(session.Expiry) {
+		return nil, nil
+	}
+
+	if session.TokenResponse != nil && session.TokenResponse.IDToken != "" {
+		// the ID token was validated when the session was established
+		if session.Claims, err = unverifiedClaims(session.TokenResponse.IDToken); err != nil {
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+func (rp *RelyingParty) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if rp.ErrorHandler != nil {
+		rp.ErrorHandler(w, r, err)
+		return
+	}
+
+	http.Error(w, "the login failed", http.StatusBadRequest)
+}
+
+func (rp *RelyingParty) sessionName() string {
+	return valueOrDefault(rp.SessionName, defaultSessionName)
+}
+
+// loginStateName returns the name under which the login with the state is kept. The state is
+// hashed because the value received on the callback may contain characters that are not allowed
+// in cookie names.
+func (rp *RelyingParty) loginStateName(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return rp.sessionName() + "_login_" + hex.EncodeToString(sum[:8])
+}
+
+func (rp *RelyingParty) sessionMaxAge() time.Duration {
+	if rp.SessionMaxAge == 0 {
+		return DefaultSessionMaxAge
+	}
+
+	return rp.SessionMaxAge
+}
+
+// unverifiedClaims returns the claims in the payload of the JWT without validating it.
+func unverifiedClaims(raw string) (typesx.Map, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errorsx.G11NError("the ID token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errorsx.G11NError("unable to decode the ID token; err=%v", err)
+	}
+
+	claims := typesx.Map{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errorsx.G11NError("unable to parse the ID token; err=%v", err)
+	}
+
+	return claims, nil
+}
+
+// isLocalPath reports whether the URL is a path on this application, which prevents the
+// return_to parameter from being used as an open redirect. Control characters and backslashes
+// are rejected because browsers strip or normalize them, such as turning "/\t/host" into
+// "//host".
+func isLocalPath(u string) bool {
+	if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") || hasControlOrBackslash(u) {
+		return false
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	return parsed.Scheme == "" && parsed.Host == "" && parsed.Opaque == "" &&
+		strings.HasPrefix(parsed.Path, "/") && !strings.HasPrefix(parsed.Path, "//") &&
+		!hasControlOrBackslash(parsed.Path)
+}
+
+func hasControlOrBackslash(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f || s[i] == '\\' {
+			return true
+		}
+	}
+
+	return false
+}
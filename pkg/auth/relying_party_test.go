@@ -0,0 +1,377 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type RelyingPartyTestSuite struct {
+	suite.Suite
+
+	ctx    context.Context
+	server *httptest.Server
+	issuer string
+	key    jose.JSONWebKey
+	nonce  string
+	cHash  string
+	rp     *auth.RelyingParty
+
+	// padding is added to the issued tokens to make them as large as typical tokens
+	padding string
+}
+
+func (s *RelyingPartyTestSuite) SetupTest() {
+	s.key = newSigningKey(s.T(), "key1")
+	s.padding = ""
+	s.cHash = ""
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2" + auth.DiscoveryEndpoint:
+			writeJSON(w, http.StatusOK, map[string]any{
+				"issuer":                 s.issuer,
+				"authorization_endpoint": s.issuer + "/authorize",
+				"token_endpoint":         s.issuer + "/token",
+				"jwks_uri":               s.issuer + "/jwks",
+				"end_session_endpoint":   s.issuer + "/logout",
+			})
+		case "/oauth2/jwks":
+			writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{s.key.Public()}})
+		case "/oauth2/token":
+			require.Equal(s.T(), "abc", r.PostFormValue("code"))
+			idTokenClaims := map[string]any{
+				"iss":   s.issuer,
+				"sub":   "user",
+				"aud":   "clientID",
+				"exp":   time.Now().Add(time.Hour).Unix(),
+				"iat":   time.Now().Unix(),
+				"nonce": s.nonce,
+				"sid":   "sessionID",
+			}
+			if s.cHash != "" {
+				idTokenClaims["c_hash"] = s.cHash
+			}
+
+			accessToken := "access"
+			if s.padding != "" {
+				idTokenClaims["groups"] = s.padding
+				accessToken = signJWT(s.T(), s.key, map[string]any{"sub": "user", "aud": "api", "groups": s.padding})
+			}
+
+			writeJSON(w, http.StatusOK, map[string]any{
+				"access_token":  accessToken,
+				"token_type":    "Bearer",
+				"expires_in":    7200,
+				"refresh_token": "refresh",
+				"id_token":      signJWT(s.T(), s.key, idTokenClaims),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	tenant := strings.TrimPrefix(s.server.URL, "https://")
+	s.issuer = s.server.URL + "/oauth2"
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+
+	store, err := auth.NewCookieSessionStore([]byte(strings.Repeat("k", 32)))
+	require.NoError(s.T(), err, "unable to create the session store")
+	store.Insecure = true
+
+	s.rp, err = auth.NewRelyingParty(&auth.Client{
+		Tenant:      tenant,
+		ClientAuth:  &auth.ClientSecretPost{ClientID: "clientID", ClientSecret: "clientSecret"},
+		RedirectURL: "http://app.example.com/callback",
+		Scopes:      []string{"openid"},
+		Discovery:   auth.NewDiscovery(tenant),
+	}, store)
+	require.NoError(s.T(), err, "unable to create the relying party")
+}
+
+func (s *RelyingPartyTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+// serve calls the handler with the cookies and returns the response.
+func (s *RelyingPartyTestSuite) serve(h http.Handler, r *http.Request, cookies []*http.Cookie) *http.Response {
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Result()
+}
+
+// login starts the login and returns the state and the login state cookies.
+func (s *RelyingPartyTestSuite) login() (string, []*http.Cookie) {
+	return s.loginWithReturnTo("/app")
+}
+
+// loginWithReturnTo starts the login with the return_to parameter, which is added to the query
+// as is, and returns the state and the login state cookies.
+func (s *RelyingPartyTestSuite) loginWithReturnTo(returnTo string) (string, []*http.Cookie) {
+	res := s.serve(s.rp.LoginHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/login?return_to="+returnTo, nil), nil)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(s.T(), err, "unable to parse the authorization URL")
+	require.Equal(s.T(), s.issuer+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+
+	s.nonce = location.Query().Get("nonce")
+	return location.Query().Get("state"), res.Cookies()
+}
+
+func (s *RelyingPartyTestSuite) TestLogin() {
+	state, cookies := s.login()
+
+	// the state must match
+	res := s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state=other", nil), cookies)
+	require.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+
+	state, cookies = s.login()
+	res = s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+state, nil), cookies)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+	require.Equal(s.T(), "/app", res.Header.Get("Location"))
+
+	var sessionCookies []*http.Cookie
+	for _, c := range res.Cookies() {
+		if c.MaxAge > 0 {
+			sessionCookies = append(sessionCookies, c)
+		}
+	}
+	require.Len(s.T(), sessionCookies, 1)
+
+	var session *auth.Session
+	protected := s.rp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session = auth.GetSession(r.Context())
+	}))
+
+	res = s.serve(protected, httptest.NewRequest(http.MethodGet, "/app", nil), sessionCookies)
+	require.Equal(s.T(), http.StatusOK, res.StatusCode)
+	require.Equal(s.T(), "user", session.Subject)
+	require.Equal(s.T(), "sessionID", session.SessionID)
+	require.Equal(s.T(), "access", session.TokenResponse.AccessToken)
+	require.Equal(s.T(), "user", session.Claims.SafeString("sub", ""))
+
+	res = s.serve(protected, httptest.NewRequest(http.MethodGet, "/app?x=1", nil), nil)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+	require.Equal(s.T(), "/login?return_to=%2Fapp%3Fx%3D1", res.Header.Get("Location"))
+
+	res = s.serve(s.rp.LogoutHandler(), httptest.NewRequest(http.MethodGet, "/logout", nil), sessionCookies)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+	require.Equal(s.T(), -1, res.Cookies()[0].MaxAge, "the session cookie should be removed")
+}
+
+func (s *RelyingPartyTestSuite) TestCodeHash() {
+	// the left half of the SHA-256 hash of the code
+	sum := sha256.Sum256([]byte("abc"))
+	s.cHash = base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+
+	state, cookies := s.login()
+	res := s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+state, nil), cookies)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+
+	s.cHash = base64.RawURLEncoding.EncodeToString(sum[len(sum)/2:])
+	state, cookies = s.login()
+	res = s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+state, nil), cookies)
+	require.NotEqual(s.T(), http.StatusFound, res.StatusCode, "the c_hash claim should be validated")
+}
+
+func (s *RelyingPartyTestSuite) TestLargeSession() {
+	s.padding = strings.Repeat("group", 140)
+
+	state, cookies := s.login()
+	res := s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+state, nil), cookies)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode, "the session should be stored")
+
+	var sessionCookies []*http.Cookie
+	for _, c := range res.Cookies() {
+		require.LessOrEqual(s.T(), len(c.String()), 4096, "the cookie %s is too large", c.Name)
+		if c.MaxAge > 0 {
+			sessionCookies = append(sessionCookies, c)
+		}
+	}
+	require.Greater(s.T(), len(sessionCookies), 1, "the session should be split across cookies")
+
+	var session *auth.Session
+	protected := s.rp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session = auth.GetSession(r.Context())
+	}))
+
+	res = s.serve(protected, httptest.NewRequest(http.MethodGet, "/app", nil), sessionCookies)
+	require.Equal(s.T(), http.StatusOK, res.StatusCode)
+	require.GreaterOrEqual(s.T(), len(session.TokenResponse.IDToken), 1000)
+	require.GreaterOrEqual(s.T(), len(session.TokenResponse.AccessToken), 1000)
+	require.Equal(s.T(), s.padding, session.Claims.SafeString("groups", ""), "the claims should be read from the ID token")
+
+	res = s.serve(s.rp.LogoutHandler(), httptest.NewRequest(http.MethodGet, "/logout", nil), sessionCookies)
+	expired := map[string]bool{}
+	for _, c := range res.Cookies() {
+		if c.MaxAge < 0 {
+			expired[c.Name] = true
+		}
+	}
+
+	for _, c := range sessionCookies {
+		require.True(s.T(), expired[c.Name], "the cookie %s should be removed", c.Name)
+	}
+}
+
+func (s *RelyingPartyTestSuite) TestParallelLogins() {
+	first, firstCookies := s.login()
+	firstNonce := s.nonce
+	second, secondCookies := s.loginWithReturnTo("/other")
+	cookies := append(firstCookies, secondCookies...)
+
+	res := s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+second, nil), cookies)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+	require.Equal(s.T(), "/other", res.Header.Get("Location"))
+
+	s.nonce = firstNonce
+	res = s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+first, nil), cookies)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode, "the first login should not be replaced by the second")
+	require.Equal(s.T(), "/app", res.Header.Get("Location"))
+}
+
+func (s *RelyingPartyTestSuite) TestReturnTo() {
+	for _, tc := range []struct {
+		returnTo string
+		location string
+	}{
+		{"/app%3Fx%3D1", "/app?x=1"},
+		{"/%09/evil.com", "/"},
+		{"/%0a/evil.com", "/"},
+		{"/%0d%0a/evil.com", "/"},
+		{"/%5C/evil.com", "/"},
+		{"/%5Cevil.com", "/"},
+		{"//evil.com", "/"},
+		{"///evil.com", "/"},
+		{"https:evil.com", "/"},
+		{"https://evil.com", "/"},
+		{"evil.com", "/"},
+		{"/%2F/evil.com", "/"},
+	} {
+		state, cookies := s.loginWithReturnTo(tc.returnTo)
+		res := s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+state, nil), cookies)
+		require.Equal(s.T(), http.StatusFound, res.StatusCode)
+		require.Equal(s.T(), tc.location, res.Header.Get("Location"), "unexpected redirect for return_to=%s", tc.returnTo)
+	}
+}
+
+func (s *RelyingPartyTestSuite) TestFormPost() {
+	s.rp.Store = auth.NewMemorySessionStore()
+	s.rp.ResponseMode = auth.ResponseModeFormPost
+
+	state, cookies := s.login()
+	require.Equal(s.T(), http.SameSiteNoneMode, cookies[0].SameSite)
+
+	r := httptest.NewRequestWithContext(s.ctx, http.MethodPost, "/callback", strings.NewReader(url.Values{
+		"code":  {"abc"},
+		"state": {state},
+	}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res := s.serve(s.rp.CallbackHandler(), r, cookies)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+	require.Equal(s.T(), "/app", res.Header.Get("Location"))
+
+	// the login state cannot be replayed
+	res = s.serve(s.rp.CallbackHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/callback?code=abc&state="+state, nil), cookies)
+	require.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+}
+
+func (s *RelyingPartyTestSuite) TestRPInitiatedLogout() {
+	s.rp.PostLogoutRedirectURI = "http://app.example.com/"
+
+	res := s.serve(s.rp.LogoutHandler(), httptest.NewRequestWithContext(s.ctx, http.MethodGet, "/logout", nil), nil)
+	require.Equal(s.T(), http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(s.T(), err, "unable to parse the logout URL")
+	require.Equal(s.T(), s.issuer+"/logout", location.Scheme+"://"+location.Host+location.Path)
+	require.Equal(s.T(), "clientID", location.Query().Get("client_id"))
+	require.Equal(s.T(), "http://app.example.com/", location.Query().Get("post_logout_redirect_uri"))
+}
+
+func (s *RelyingPartyTestSuite) TestBackchannelLogout() {
+	var loggedOut []string
+	h := auth.NewBackchannelLogoutHandler(s.rp.Verifier, func(ctx context.Context, claims *auth.LogoutTokenClaims) error {
+		loggedOut = append(loggedOut, claims.SessionID)
+		return nil
+	})
+
+	claims := func() map[string]any {
+		return map[string]any{
+			"iss":    s.issuer,
+			"aud":    "clientID",
+			"iat":    time.Now().Unix(),
+			"jti":    "jti1",
+			"sid":    "sessionID",
+			"events": map[string]any{auth.BackchannelLogoutEvent: map[string]any{}},
+		}
+	}
+
+	post := func(c map[string]any) int {
+		r := httptest.NewRequestWithContext(s.ctx, http.MethodPost, "/backchannel_logout", strings.NewReader(url.Values{
+			"logout_token": {signJWT(s.T(), s.key, c)},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return s.serve(h, r, nil).StatusCode
+	}
+
+	require.Equal(s.T(), http.StatusOK, post(claims()))
+	require.Equal(s.T(), []string{"sessionID"}, loggedOut)
+	require.Equal(s.T(), http.StatusBadRequest, post(claims()), "a replayed token should be rejected")
+
+	for name, mutate := range map[string]func(map[string]any){
+		"nonce":    func(c map[string]any) { c["nonce"] = "nonce" },
+		"events":   func(c map[string]any) { delete(c, "events") },
+		"sub/sid":  func(c map[string]any) { delete(c, "sid") },
+		"audience": func(c map[string]any) { c["aud"] = "other" },
+		"old":      func(c map[string]any) { c["iat"] = time.Now().Add(-time.Hour).Unix() },
+	} {
+		c := claims()
+		c["jti"] = name
+		mutate(c)
+		require.Equal(s.T(), http.StatusBadRequest, post(c), "expected %s to be rejected", name)
+	}
+
+	require.Len(s.T(), loggedOut, 1)
+
+	// a failed logout is not recorded, so the token can be delivered again
+	failures := 1
+	h.OnLogout = func(ctx context.Context, claims *auth.LogoutTokenClaims) error {
+		if failures > 0 {
+			failures--
+			return errors.New("the session store is unavailable")
+		}
+
+		loggedOut = append(loggedOut, claims.SessionID)
+		return nil
+	}
+
+	c := claims()
+	c["jti"] = "jti2"
+	require.Equal(s.T(), http.StatusBadRequest, post(c), "the logout should fail")
+	require.Equal(s.T(), http.StatusOK, post(c), "the token should be accepted again after a failed logout")
+	require.Len(s.T(), loggedOut, 2)
+	require.Equal(s.T(), http.StatusBadRequest, post(c), "a replayed token should be rejected")
+}
+
+func TestRelyingPartyTestSuite(t *testing.T) {
+	suite.Run(t, new(RelyingPartyTestSuite))
+}
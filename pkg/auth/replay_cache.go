@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// replayCache remembers identifiers, such as the jti of a JWT, until they expire so that
+// a token presented more than once can be detected. It is safe for concurrent use.
+type replayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	expiry  replayHeap
+}
+
+// seen records the identifier until the expiry and reports whether it was already recorded.
+func (c *replayCache) seen(id string, expiry time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]time.Time{}
+	}
+
+	// only the entries that have expired are visited, in order of expiry
+	now := time.Now()
+	for len(c.expiry) > 0 && now.After(c.expiry[0].expiry) {
+		delete(c.entries, heap.Pop(&c.expiry).(replayEntry).id)
+	}
+
+	if _, ok := c.entries[id]; ok {
+		return true
+	}
+
+	c.entries[id] = expiry
+	heap.Push(&c.expiry, replayEntry{id: id, expiry: expiry})
+	return false
+}
+
+// has reports whether the identifier is recorded and has not expired, without recording it.
+func (c *replayCache) has(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiry, ok := c.entries[id]
+	return ok && !time.Now().After(expiry)
+}
+
+// replayEntry is an identifier in the replayCache and its expiry.
+type replayEntry struct {
+	id     string
+	expiry time.Time
+}
+
+// replayHeap orders the entries of the replayCache by expiry. It implements heap.Interface.
+type replayHeap []replayEntry
+
+func (h replayHeap) Len() int           { return len(h) }
+func (h replayHeap) Less(i, j int) bool { return h[i].expiry.Before(h[j].expiry) }
+func (h replayHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *replayHeap) Push(x any) {
+	*h = append(*h, x.(replayEntry))
+}
+
+func (h *replayHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
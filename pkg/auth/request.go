@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	"golang.org/x/oauth2"
+)
+
+// contextHTTPClient returns the http.Client set on the context using the oauth2.HTTPClient key,
+// which is the same client used by the golang.org/x/oauth2 based grants.
+func contextHTTPClient(ctx context.Context) *http.Client {
+	if hc, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && hc != nil {
+		return hc
+	}
+
+	return http.DefaultClient
+}
+
+// httpClient returns the http.Client used to call the endpoint. The client certificate is
+// presented when a mutual-TLS ClientAuth is configured, the headers of a HeaderClientAuth are
+// added to requests to the endpoints that authenticate the client, and DPoP proofs are added to requests
+// to the token and UserInfo endpoints when DPoP is configured.
+func (c *Client) httpClient(ctx context.Context, e endpoint) (*http.Client, error) {
+	hc := contextHTTPClient(ctx)
+	if certAuth, ok := c.ClientAuth.(certificateClientAuth); ok {
+		var err error
+		if hc, err = withClientCertificate(hc, certAuth.clientCertificate()); err != nil {
+			return nil, err
+		}
+	}
+
+	if headerAuth, ok := c.ClientAuth.(HeaderClientAuth); ok && e.authenticatesClient() {
+		header, err := headerAuth.GetHeaders()
+		if err != nil {
+			return nil, err
+		}
+
+		hc = withHeaders(hc, header)
+	}
+
+	if c.DPoP != nil && (e == tokenEndpoint || e == userinfoEndpoint) {
+		hc = c.DPoP.HTTPClient(hc)
+	}
+
+	return hc, nil
+}
+
+// oauth2Context returns a context holding the http.Client used to call the endpoint, for the
+// golang.org/x/oauth2 based grants.
+func (c *Client) oauth2Context(ctx context.Context, e endpoint) (context.Context, error) {
+	hc, err := c.httpClient(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	return context.WithValue(ctx, oauth2.HTTPClient, hc), nil
+}
+
+// postForm authenticates the client using the configured ClientAuth and posts the
+// parameters to the endpoint. The response body is returned for any status code.
+func (c *Client) postForm(ctx context.Context, e endpoint, parameters url.Values) (*http.Response, []byte, error) {
+	endpointURL, err := c.endpoint(ctx, e)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hc, err := c.httpClient(ctx, e)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params, err := c.ClientAuth.GetParameters()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for k, v := range parameters {
+		params[k] = v
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, nil, errorsx.G11NError("unable to read the response; err=%v", err)
+	}
+
+	return res, body, nil
+}
+
+// tokenRequest posts the parameters to the token endpoint and parses the token response.
+func (c *Client) tokenRequest(ctx context.Context, parameters url.Values) (*TokenResponse, error) {
+	res, body, err := c.postForm(ctx, tokenEndpoint, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newResponseError(res, body)
+	}
+
+	tr := &TokenResponse{}
+	if err := json.Unmarshal(body, tr); err != nil {
+		return nil, errorsx.G11NError("unable to parse the token response; err=%v", err)
+	}
+
+	if tr.AccessToken == "" {
+		return nil, errorsx.G11NError("the token response does not contain an access token")
+	}
+
+	if tr.ExpiresIn > 0 {
+		tr.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	return tr, nil
+}
+
+// newResponseError converts an unsuccessful response into an OAuthError, using the error in
+// the body or the WWW-Authenticate header. If neither contains an error code, the body is
+// returned as the description.
+func newResponseError(res *http.Response, body []byte) error {
+	oauthErr := &OAuthError{}
+	if err := json.Unmarshal(body, oauthErr); err != nil {
+		oauthErr = &OAuthError{}
+	}
+
+	oauthErr.StatusCode = res.StatusCode
+	oauthErr = newOAuthErrorFromHeader(oauthErr, res.Header)
+	if oauthErr.Code == "" {
+		oauthErr.Description = strings.TrimSpace(string(body))
+	}
+
+	return oauthErr
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/google/uuid"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+const (
+	// RequestObjectType is the typ header of request objects, as described in RFC 9101.
+	RequestObjectType = "oauth-authz-req+jwt"
+)
+
+// RequestObjectOptions configures the authorization parameters to be sent as a signed, and
+// optionally encrypted, request object (JAR), as described in RFC 9101.
+type RequestObjectOptions struct {
+	// SigningKey contains the JSONWebKey representation of the private key used to sign
+	// the request object. The KeyID and Algorithm are expected to be populated.
+	SigningKey *jose.JSONWebKey
+
+	// EncryptionKey optionally contains the JSONWebKey representation of the public key of
+	// the authorization server used to encrypt the signed request object. The Algorithm is
+	// expected to be populated with the key management algorithm, such as RSA-OAEP-256.
+	EncryptionKey *jose.JSONWebKey
+
+	// ContentEncryption optionally specifies the content encryption algorithm used when
+	// EncryptionKey is set. By default, this is set to A256GCM.
+	ContentEncryption jose.ContentEncryption
+
+	// Expires optionally specifies how long the request object is valid for. By default,
+	// this is set to 5 mins.
+	Expires time.Duration
+}
+
+// requestObjectParameters packages the authorization parameters into a request object and
+// returns the parameters to send in their place.
+func (c *Client) requestObjectParameters(ctx context.Context, params url.Values) (url.Values, error) {
+	opts := c.RequestObject
+	alg := ""
+	if opts.SigningKey != nil {
+		alg = opts.SigningKey.Algorithm
+	}
+
+	issuer := c.issuer()
+	if c.Discovery != nil {
+		config, err := c.Discovery.Configuration(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(config.RequestObjectSigningAlgValuesSupported) > 0 && !typesx.StringSlice(config.RequestObjectSigningAlgValuesSupported).ContainsString(alg) {
+			return nil, errorsx.G11NError("the request object signing algorithm '%s' is not supported", alg)
+		}
+
+		issuer = config.Issuer
+	}
+
+	expires := opts.Expires
+	if expires == 0 {
+		expires = 5 * time.Minute
+	}
+
+	now := time.Now().UTC()
+	claims, err := requestObjectClaims(params)
+	if err != nil {
+		return nil, err
+	}
+
+	claims["iss"] = params.Get("client_id")
+	claims["aud"] = issuer
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(expires).Unix()
+	claims["jti"] = uuid.NewString()
+
+	token, err := signJWT(opts.SigningKey, RequestObjectType, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.EncryptionKey != nil {
+		if token, err = encryptJWT(opts.EncryptionKey, opts.ContentEncryption, token); err != nil {
+			return nil, err
+		}
+	}
+
+	// response_type and scope are repeated for compatibility with OpenID Connect
+	ret := url.Values{
+		"client_id": {params.Get("client_id")},
+		"request":   {token},
+	}
+
+	if params.Has("response_type") {
+		ret.Set("response_type", params.Get("response_type"))
+	}
+
+	if params.Has("scope") {
+		ret.Set("scope", params.Get("scope"))
+	}
+
+	return ret, nil
+}
+
+// requestObjectClaims converts the authorization parameters to request object claims. The
+// parameters repeated in the request are kept as arrays and the parameters that are not
+// strings are decoded to their JSON types.
+func requestObjectClaims(params url.Values) (map[string]any, error) {
+	claims := map[string]any{}
+	for k, v := range params {
+		if len(v) > 1 {
+			claims[k] = v
+		} else {
+			claims[k] = params.Get(k)
+		}
+	}
+
+	// authorization_details is a JSON array in the request object, as described in RFC 9396
+	if params.Has("authorization_details") {
+		var details []AuthorizationDetail
+		if err := json.Unmarshal([]byte(params.Get("authorization_details")), &details); err != nil {
+			return nil, errorsx.G11NError("unable to parse the authorization details; err=%v", err)
+		}
+
+		claims["authorization_details"] = details
+	}
+
+	// claims is a JSON object, as described in OpenID Connect Core 1.0 section 5.5
+	if params.Has("claims") {
+		var requested map[string]any
+		if err := json.Unmarshal([]byte(params.Get("claims")), &requested); err != nil {
+			return nil, errorsx.G11NError("unable to parse the claims parameter; err=%v", err)
+		}
+
+		claims["claims"] = requested
+	}
+
+	// max_age is a number of seconds
+	if params.Has("max_age") {
+		maxAge, err := strconv.ParseInt(params.Get("max_age"), 10, 64)
+		if err != nil {
+			return nil, errorsx.G11NError("the max_age parameter is not an integer; err=%v", err)
+		}
+
+		claims["max_age"] = maxAge
+	}
+
+	return claims, nil
+}
+
+// encryptJWT encrypts the signed JWT as a nested JWT using the public key.
+func encryptJWT(key *jose.JSONWebKey, enc jose.ContentEncryption, token string) (string, error) {
+	if enc == "" {
+		enc = jose.A256GCM
+	}
+
+	encrypter, err := jose.NewEncrypter(enc, jose.Recipient{
+		Algorithm: jose.KeyAlgorithm(key.Algorithm),
+		Key:       key,
+		KeyID:     key.KeyID,
+	}, (&jose.EncrypterOptions{}).WithContentType("JWT"))
+	if err != nil {
+		return "", err
+	}
+
+	jwe, err := encrypter.Encrypt([]byte(token))
+	if err != nil {
+		return "", errorsx.G11NError("unable to encrypt the token; err=%v", err)
+	}
+
+	return jwe.CompactSerialize()
+}
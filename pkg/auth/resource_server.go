@@ -0,0 +1,548 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	contextx "github.com/ibm-verify/verify-sdk-go/pkg/core/context"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	"github.com/ibm-verify/verify-sdk-go/x/logx"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+const (
+	// DefaultDPoPProofLifetime is how long a DPoP proof is accepted after it is issued.
+	DefaultDPoPProofLifetime = 5 * time.Minute
+)
+
+// asymmetricAlgorithms lists the asymmetric algorithms accepted by default for DPoP proofs and
+// JWT access tokens.
+var asymmetricAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// Confirmation contains the cnf claim that binds an access token to a key or certificate.
+type Confirmation struct {
+	// JWKThumbprint is the SHA-256 thumbprint of the DPoP public key the token is bound to.
+	JWKThumbprint string `json:"jkt,omitempty"`
+
+	// X509Thumbprint is the SHA-256 thumbprint of the client certificate the token is bound to.
+	X509Thumbprint string `json:"x5t#S256,omitempty"`
+}
+
+// AccessTokenClaims contains the claims of an access token validated by a ResourceServer.
+type AccessTokenClaims struct {
+	jwt.Claims
+
+	// Scope is the space-delimited list of scopes associated with the token.
+	Scope string `json:"scope,omitempty"`
+
+	// ClientID is the identifier of the client that requested the token.
+	ClientID string `json:"client_id,omitempty"`
+
+	// Confirmation is set when the token is bound to a DPoP key or client certificate.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// Raw contains all the claims of the token, including those that are not well known.
+	Raw typesx.Map `json:"-"`
+}
+
+// Scopes returns the scopes associated with the token.
+func (c *AccessTokenClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// AccessRequirements contains the requirements an access token must meet to access a route.
+type AccessRequirements struct {
+	// Scopes lists the scopes that must all be granted to the token.
+	Scopes []string
+
+	// Audiences lists the audiences of which at least one must be in the token. If empty,
+	// ResourceServer.Audiences is used.
+	Audiences []string
+}
+
+// ResourceServer validates access tokens issued by the tenant for APIs protected by Verify.
+// JWT access tokens are validated locally using the tenant JSON Web Key Set and opaque tokens
+// are introspected. Tokens bound using DPoP or mutual TLS are validated against the proof or
+// client certificate presented with the request. It is safe for concurrent use.
+type ResourceServer struct {
+	// Discovery provides the issuer, jwks_uri and supported signing algorithms.
+	Discovery *Discovery
+
+	// KeySet optionally overrides the key set used to verify signatures. By default,
+	// the RemoteKeySet for the jwks_uri in the discovery document is used, which is shared
+	// with the other resource servers and clients using the same jwks_uri.
+	KeySet *RemoteKeySet
+
+	// Introspector is the client used to introspect tokens that are not JWTs. If not set,
+	// opaque tokens are rejected.
+	Introspector *Client
+
+	// Audiences lists the audiences accepted by default when a route does not specify any.
+	// An audience is required, so requests are rejected if neither is configured.
+	Audiences []string
+
+	// SigningAlgorithms lists the algorithms accepted for JWT access token signatures. By
+	// default, the RSA, ECDSA and EdDSA algorithms are accepted.
+	SigningAlgorithms []jose.SignatureAlgorithm
+
+	// AllowAnyTokenType disables the check that JWT access tokens have the 'typ' header
+	// 'at+jwt' described in RFC 9068, for authorization servers that do not set it.
+	AllowAnyTokenType bool
+
+	// BaseURL optionally specifies the scheme and host of the external URL of the resource
+	// server, such as https://api.example.com, which is used to validate the htu claim of
+	// DPoP proofs when the server is behind a proxy. By default, it is derived from the request.
+	BaseURL string
+
+	// ClockSkew is the leeway allowed when validating time based claims. By default, this is
+	// set to DefaultClockSkew.
+	ClockSkew time.Duration
+
+	// Logger optionally logs the reason requests are rejected by Middleware, which is not
+	// sent to the caller. By default, the logger in the VerifyContext of the request is used.
+	Logger *logx.Logger
+
+	dpopJTIs replayCache
+}
+
+// NewResourceServer returns a ResourceServer that validates tokens issued by the tenant.
+func NewResourceServer(discovery *Discovery) *ResourceServer {
+	return &ResourceServer{
+		Discovery: discovery,
+	}
+}
+
+// NewContextWithAccessTokenClaims returns a context holding the validated access token claims.
+func NewContextWithAccessTokenClaims(parentContext context.Context, claims *AccessTokenClaims) context.Context {
+	return context.WithValue(parentContext, contextx.AccessTokenClaimsCtxKey, claims)
+}
+
+// GetAccessTokenClaims returns the access token claims validated by ResourceServer.Middleware,
+// or nil if there are none.
+func GetAccessTokenClaims(ctx context.Context) *AccessTokenClaims {
+	claims, _ := ctx.Value(contextx.AccessTokenClaimsCtxKey).(*AccessTokenClaims)
+	return claims
+}
+
+// Middleware returns net/http middleware that rejects requests without a valid access token
+// that meets the requirements. The validated claims are available to the next handler
+// using GetAccessTokenClaims.
+func (rs *ResourceServer) Middleware(requirements *AccessRequirements) func(http.Handler) http.Handler {
+	if requirements == nil {
+		requirements = &AccessRequirements{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := rs.ValidateRequest(r, requirements)
+			if err != nil {
+				rs.logRejection(r.Context(), err)
+				writeChallenge(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContextWithAccessTokenClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// ValidateRequest validates the access token presented in the Authorization header of the
+// request, including the DPoP proof or client certificate if the token is bound, and checks
+// that it meets the requirements. Errors are returned as *OAuthError. When the token cannot be
+// validated because the discovery document, key set or introspection endpoint is unavailable,
+// or no audience is configured, the StatusCode is a 5xx status and the Code is empty.
+func (rs *ResourceServer) ValidateRequest(r *http.Request, requirements *AccessRequirements) (*AccessTokenClaims, error) {
+	ctx := r.Context()
+	audiences := requirements.Audiences
+	if len(audiences) == 0 {
+		audiences = rs.Audiences
+	}
+
+	if len(audiences) == 0 {
+		return nil, &OAuthError{
+			Description: "no audience is configured for the resource server",
+			StatusCode:  http.StatusInternalServerError,
+		}
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" || (!strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, "DPoP")) {
+		return nil, &OAuthError{StatusCode: http.StatusUnauthorized}
+	}
+
+	claims, err := rs.validateToken(ctx, token)
+	if err != nil {
+		var unavailableErr *unavailableError
+		if errors.As(err, &unavailableErr) {
+			return nil, &OAuthError{
+				Description: err.Error(),
+				StatusCode:  http.StatusServiceUnavailable,
+			}
+		}
+
+		return nil, &OAuthError{
+			Code:        "invalid_token",
+			Description: err.Error(),
+			StatusCode:  http.StatusUnauthorized,
+		}
+	}
+
+	if err := rs.validateBinding(r, strings.EqualFold(scheme, "DPoP"), token, claims); err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, aud := range audiences {
+		if claims.Audience.Contains(aud) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return nil, &OAuthError{
+			Code:        "invalid_token",
+			Description: "the token audience is not accepted",
+			StatusCode:  http.StatusUnauthorized,
+		}
+	}
+
+	granted := typesx.FromArray(claims.Scopes())
+	for _, scope := range requirements.Scopes {
+		if !granted.Contains(scope) {
+			return nil, &OAuthError{
+				Code:        "insufficient_scope",
+				Description: fmt.Sprintf("the token requires the scopes '%s'", strings.Join(requirements.Scopes, " ")),
+				StatusCode:  http.StatusForbidden,
+			}
+		}
+	}
+
+	return claims, nil
+}
+
+func (rs *ResourceServer) validateToken(ctx context.Context, token string) (*AccessTokenClaims, error) {
+	if strings.Count(token, ".") != 2 {
+		return rs.introspect(ctx, token)
+	}
+
+	algs := rs.SigningAlgorithms
+	if len(algs) == 0 {
+		algs = asymmetricAlgorithms
+	}
+
+	parsed, err := jwt.ParseSigned(token, algs)
+	if err != nil {
+		return nil, errorsx.G11NError("unable to parse the token; err=%v", err)
+	}
+
+	if len(parsed.Headers) != 1 {
+		return nil, errorsx.G11NError("the token must have a single signature")
+	}
+
+	header := parsed.Headers[0]
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); !rs.AllowAnyTokenType &&
+		!strings.EqualFold(typ, "at+jwt") && !strings.EqualFold(typ, "application/at+jwt") {
+		return nil, errorsx.G11NError("the token 'typ' must be 'at+jwt'")
+	}
+
+	config, err := rs.Discovery.Configuration(ctx)
+	if err != nil {
+		return nil, &unavailableError{err: err}
+	}
+
+	keySet, err := remoteKeySet(rs.KeySet, config.JSONWebKeySetURI)
+	if err != nil {
+		return nil, &unavailableError{err: err}
+	}
+
+	key, err := keySet.Key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &AccessTokenClaims{}
+	if err := parsed.Claims(key, claims, &claims.Raw); err != nil {
+		return nil, errorsx.G11NError("unable to verify the token; err=%v", err)
+	}
+
+	if claims.Expiry == nil {
+		return nil, errorsx.G11NError("the token must contain 'exp'")
+	}
+
+	if err := claims.ValidateWithLeeway(jwt.Expected{
+		Issuer: config.Issuer,
+	}, rs.clockSkew()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (rs *ResourceServer) introspect(ctx context.Context, token string) (*AccessTokenClaims, error) {
+	if rs.Introspector == nil {
+		return nil, errorsx.G11NError("the token is not a JWT")
+	}
+
+	res, err := rs.Introspector.IntrospectToken(ctx, token, TokenTypeHintAccessToken)
+	if err != nil {
+		return nil, &unavailableError{err: err}
+	}
+
+	if !res.Active {
+		return nil, errorsx.G11NError("the token is not active")
+	}
+
+	b, err := json.Marshal(res.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &AccessTokenClaims{}
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, errorsx.G11NError("unable to parse the introspection response; err=%v", err)
+	}
+
+	claims.Raw = res.Claims
+	return claims, nil
+}
+
+// validateBinding validates the DPoP proof or the client certificate if the token is bound
+// to either, as described in RFC 9449 and RFC 8705.
+func (rs *ResourceServer) validateBinding(r *http.Request, dpopScheme bool, token string, claims *AccessTokenClaims) error {
+	cnf := claims.Confirmation
+	if cnf == nil {
+		cnf = &Confirmation{}
+	}
+
+	if dpopScheme || cnf.JWKThumbprint != "" {
+		if !dpopScheme {
+			return &OAuthError{
+				Code:        "invalid_token",
+				Description: "the token is bound to a DPoP key and must use the DPoP scheme",
+				StatusCode:  http.StatusUnauthorized,
+			}
+		}
+
+		if cnf.JWKThumbprint == "" {
+			return &OAuthError{
+				Code:        "invalid_token",
+				Description: "the token is not bound to a DPoP key",
+				StatusCode:  http.StatusUnauthorized,
+			}
+		}
+
+		if err := rs.validateDPoPProof(r, token, cnf.JWKThumbprint); err != nil {
+			return &OAuthError{
+				Code:        "invalid_dpop_proof",
+				Description: err.Error(),
+				StatusCode:  http.StatusUnauthorized,
+			}
+		}
+	}
+
+	if cnf.X509Thumbprint != "" {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return &OAuthError{
+				Code:        "invalid_token",
+				Description: "the token is bound to a client certificate that was not presented",
+				StatusCode:  http.StatusUnauthorized,
+			}
+		}
+
+		sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+		if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(cnf.X509Thumbprint)) != 1 {
+			return &OAuthError{
+				Code:        "invalid_token",
+				Description: "the token is bound to a different client certificate",
+				StatusCode:  http.StatusUnauthorized,
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rs *ResourceServer) validateDPoPProof(r *http.Request, token string, jkt string) error {
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return errorsx.G11NError("a single DPoP proof is required")
+	}
+
+	proof, err := jwt.ParseSigned(proofs[0], asymmetricAlgorithms)
+	if err != nil {
+		return errorsx.G11NError("unable to parse the DPoP proof; err=%v", err)
+	}
+
+	header := proof.Headers[0]
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != "dpop+jwt" {
+		return errorsx.G11NError("the DPoP proof 'typ' must be 'dpop+jwt'")
+	}
+
+	if header.JSONWebKey == nil || !header.JSONWebKey.IsPublic() {
+		return errorsx.G11NError("the DPoP proof must contain a public 'jwk'")
+	}
+
+	thumbprint, err := header.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(thumbprint)), []byte(jkt)) != 1 {
+		return errorsx.G11NError("the DPoP proof key does not match the token")
+	}
+
+	claims := &dpopProofClaims{}
+	if err := proof.Claims(header.JSONWebKey, claims); err != nil {
+		return errorsx.G11NError("unable to verify the DPoP proof; err=%v", err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return errorsx.G11NError("the DPoP proof must contain 'jti' and 'iat'")
+	}
+
+	iat := claims.IssuedAt.Time()
+	if time.Since(iat) > DefaultDPoPProofLifetime+rs.clockSkew() || time.Until(iat) > rs.clockSkew() {
+		return errorsx.G11NError("the DPoP proof has expired or was issued in the future")
+	}
+
+	if claims.HTTPMethod != r.Method {
+		return errorsx.G11NError("the DPoP proof 'htm' does not match the request")
+	}
+
+	if claims.HTTPURI != rs.requestURI(r) {
+		return errorsx.G11NError("the DPoP proof 'htu' does not match the request")
+	}
+
+	ath := sha256.Sum256([]byte(token))
+	if claims.AccessTokenHash != base64.RawURLEncoding.EncodeToString(ath[:]) {
+		return errorsx.G11NError("the DPoP proof 'ath' does not match the token")
+	}
+
+	if rs.dpopJTIs.seen(claims.ID, iat.Add(DefaultDPoPProofLifetime+2*rs.clockSkew())) {
+		return errorsx.G11NError("the DPoP proof has already been used")
+	}
+
+	return nil
+}
+
+// requestURI returns the URI of the request without the query and fragment.
+func (rs *ResourceServer) requestURI(r *http.Request) string {
+	if rs.BaseURL != "" {
+		return strings.TrimSuffix(rs.BaseURL, "/") + r.URL.Path
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+}
+
+func (rs *ResourceServer) clockSkew() time.Duration {
+	if rs.ClockSkew == 0 {
+		return DefaultClockSkew
+	}
+
+	return rs.ClockSkew
+}
+
+// unavailableError is returned when a token cannot be validated because the discovery document,
+// key set or introspection endpoint is unavailable, which is not a fault of the token.
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// dpopProofClaims contains the claims of a DPoP proof.
+type dpopProofClaims struct {
+	jwt.Claims
+
+	HTTPMethod      string `json:"htm"`
+	HTTPURI         string `json:"htu"`
+	AccessTokenHash string `json:"ath,omitempty"`
+	Nonce           string `json:"nonce,omitempty"`
+}
+
+// logRejection logs the reason the request was rejected, if a logger is available.
+func (rs *ResourceServer) logRejection(ctx context.Context, err error) {
+	logger := rs.Logger
+	if logger == nil {
+		if vc := contextx.GetVerifyContext(ctx); vc != nil {
+			logger = vc.Logger
+		}
+	}
+
+	if logger == nil {
+		return
+	}
+
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) && oauthErr.StatusCode < http.StatusInternalServerError {
+		logger.Debugf("the request is not authorized; err=%v", err)
+		return
+	}
+
+	logger.Errorf("unable to validate the request; err=%v", err)
+}
+
+// challengeDescriptions contains the error_description sent for each error code. The
+// description of the error is not sent because it may contain internal details, such as
+// transport errors, and characters that are not allowed in the header.
+var challengeDescriptions = map[string]string{
+	"invalid_token":      "The access token is invalid.",
+	"invalid_dpop_proof": "The DPoP proof is invalid.",
+	"insufficient_scope": "The access token does not have the required scopes.",
+}
+
+// writeChallenge writes the error response with the WWW-Authenticate challenge described in
+// RFC 6750 section 3 and RFC 9449 section 7.1. Server errors are written without a challenge.
+func writeChallenge(w http.ResponseWriter, err error) {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &OAuthError{Code: "invalid_token", Description: err.Error(), StatusCode: http.StatusUnauthorized}
+	}
+
+	if oauthErr.StatusCode >= http.StatusInternalServerError {
+		w.WriteHeader(oauthErr.StatusCode)
+		return
+	}
+
+	scheme := "Bearer"
+	if oauthErr.Code == "invalid_dpop_proof" {
+		scheme = "DPoP"
+	}
+
+	challenge := scheme
+	if description, ok := challengeDescriptions[oauthErr.Code]; ok {
+		challenge = fmt.Sprintf(`%s error="%s", error_description="%s"`, scheme, oauthErr.Code, description)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.WriteHeader(oauthErr.StatusCode)
+}
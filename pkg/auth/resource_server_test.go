@@ -0,0 +1,215 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/google/uuid"
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/ibm-verify/verify-sdk-go/x/logx"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type ResourceServerTestSuite struct {
+	suite.Suite
+
+	ctx     context.Context
+	server  *httptest.Server
+	issuer  string
+	key     jose.JSONWebKey
+	rs      *auth.ResourceServer
+	handler http.Handler
+	keysErr bool
+}
+
+func (s *ResourceServerTestSuite) SetupTest() {
+	s.key = newSigningKey(s.T(), "key1")
+	s.keysErr = false
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2" + auth.DiscoveryEndpoint:
+			writeJSON(w, http.StatusOK, map[string]any{
+				"issuer":   s.issuer,
+				"jwks_uri": s.issuer + "/jwks",
+			})
+		case "/oauth2/jwks":
+			if s.keysErr {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{s.key.Public()}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	tenant := strings.TrimPrefix(s.server.URL, "https://")
+	s.issuer = "https://" + tenant + "/oauth2"
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+	s.rs = auth.NewResourceServer(auth.NewDiscovery(tenant))
+	s.rs.BaseURL = "https://api.example.com"
+	s.handler = s.rs.Middleware(&auth.AccessRequirements{
+		Scopes:    []string{"read"},
+		Audiences: []string{"api"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.GetAccessTokenClaims(r.Context())
+		_, _ = w.Write([]byte(claims.Subject))
+	}))
+}
+
+func (s *ResourceServerTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *ResourceServerTestSuite) token(scope string, cnf map[string]any) string {
+	return s.typedToken("at+jwt", scope, cnf)
+}
+
+func (s *ResourceServerTestSuite) typedToken(typ jose.ContentType, scope string, cnf map[string]any) string {
+	claims := map[string]any{
+		"iss":   s.issuer,
+		"sub":   "user",
+		"aud":   "api",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"scope": scope,
+	}
+	if cnf != nil {
+		claims["cnf"] = cnf
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: s.key}, (&jose.SignerOptions{}).WithType(typ))
+	require.NoError(s.T(), err, "unable to create a signer")
+	raw, err := jwt.Signed(signer).Claims(claims).Serialize()
+	require.NoError(s.T(), err, "unable to sign the token")
+	return raw
+}
+
+func (s *ResourceServerTestSuite) serve(authorization string, dpop string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com/resource?x=1", nil).WithContext(s.ctx)
+	req.Header.Set("Authorization", authorization)
+	if dpop != "" {
+		req.Header.Set("DPoP", dpop)
+	}
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (s *ResourceServerTestSuite) TestBearerToken() {
+	w := s.serve("Bearer "+s.token("openid read", nil), "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+	require.Equal(s.T(), "user", w.Body.String())
+
+	w = s.serve("Bearer "+s.token("openid", nil), "")
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+	require.Contains(s.T(), w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+
+	w = s.serve("Bearer invalid.token.value", "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+
+	w = s.serve("", "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+	require.Equal(s.T(), "Bearer", w.Header().Get("WWW-Authenticate"))
+}
+
+func (s *ResourceServerTestSuite) TestTokenType() {
+	w := s.serve("Bearer "+s.typedToken("application/at+jwt", "read", nil), "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.serve("Bearer "+s.typedToken("JWT", "read", nil), "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code, "an ID token must not be accepted as an access token")
+	require.Contains(s.T(), w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+	s.rs.AllowAnyTokenType = true
+	w = s.serve("Bearer "+s.typedToken("JWT", "read", nil), "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+}
+
+func (s *ResourceServerTestSuite) TestChallengeDescription() {
+	logs := &bytes.Buffer{}
+	s.rs.Logger = logx.NewLoggerWithWriter("test", slog.LevelDebug, logs)
+
+	w := s.serve("Bearer invalid.\r\nX-Injected: 1.value", "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+	require.Equal(s.T(), `Bearer error="invalid_token", error_description="The access token is invalid."`, w.Header().Get("WWW-Authenticate"))
+	require.Contains(s.T(), logs.String(), "unable to parse the token", "the reason should be logged")
+
+	logs.Reset()
+	s.keysErr = true
+	w = s.serve("Bearer "+s.token("read", nil), "")
+	require.Equal(s.T(), http.StatusServiceUnavailable, w.Code)
+	require.Contains(s.T(), logs.String(), "unable to fetch the key set", "the reason should be logged")
+}
+
+func (s *ResourceServerTestSuite) TestAudienceRequired() {
+	handler := s.rs.Middleware(&auth.AccessRequirements{Scopes: []string{"read"}})(http.NotFoundHandler())
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com/resource", nil).WithContext(s.ctx)
+	req.Header.Set("Authorization", "Bearer "+s.token("read", nil))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(s.T(), http.StatusInternalServerError, w.Code, "the audience must be configured")
+	require.Empty(s.T(), w.Header().Get("WWW-Authenticate"))
+}
+
+func (s *ResourceServerTestSuite) TestKeySetUnavailable() {
+	s.keysErr = true
+	w := s.serve("Bearer "+s.token("read", nil), "")
+	require.Equal(s.T(), http.StatusServiceUnavailable, w.Code)
+	require.Empty(s.T(), w.Header().Get("WWW-Authenticate"))
+}
+
+func (s *ResourceServerTestSuite) TestDPoPBoundToken() {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(s.T(), err, "unable to generate a key")
+	dpopKey := jose.JSONWebKey{Key: &ecKey.PublicKey, Algorithm: string(jose.ES256)}
+	thumbprint, err := dpopKey.Thumbprint(crypto.SHA256)
+	require.NoError(s.T(), err, "unable to compute the thumbprint")
+
+	token := s.token("read", map[string]any{"jkt": base64.RawURLEncoding.EncodeToString(thumbprint)})
+	ath := sha256.Sum256([]byte(token))
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: ecKey}, (&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt"))
+	require.NoError(s.T(), err, "unable to create a signer")
+
+	proof, err := jwt.Signed(signer).Claims(map[string]any{
+		"jti": uuid.NewString(),
+		"htm": http.MethodGet,
+		"htu": "https://api.example.com/resource",
+		"iat": time.Now().Unix(),
+		"ath": base64.RawURLEncoding.EncodeToString(ath[:]),
+	}).Serialize()
+	require.NoError(s.T(), err, "unable to sign the proof")
+
+	w := s.serve("Bearer "+token, "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code, "a bound token must use the DPoP scheme")
+
+	w = s.serve("DPoP "+token, proof)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.serve("DPoP "+token, proof)
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code, "the proof must not be replayed")
+	require.Contains(s.T(), w.Header().Get("WWW-Authenticate"), `DPoP error="invalid_dpop_proof"`)
+}
+
+func TestResourceServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ResourceServerTestSuite))
+}
@@ -1,6 +1,10 @@
 package auth
 
-import "golang.org/x/oauth2"
+import (
+	"time"
+
+	"golang.org/x/oauth2"
+)
 
 type AuthorizeResponse struct {
 	State string
@@ -8,6 +12,17 @@ type AuthorizeResponse struct {
 	AuthCodeURL string
 
 	PKCECodeVerifier string
+
+	// Nonce is the value sent in the authorization request to bind the ID token to
+	// this request. It is validated using IDTokenVerifier.VerifyTokenResponse.
+	Nonce string
+
+	// RequestURI is the request_uri returned by the PAR endpoint when the flow is started
+	// using AuthorizeWithPushedAuthorizationRequest.
+	RequestURI string
+
+	// RequestURIExpiry is the time after which the RequestURI can no longer be used.
+	RequestURIExpiry time.Time
 }
 
 type DeviceAuthResponse = oauth2.DeviceAuthResponse
@@ -34,6 +49,16 @@ type TokenResponse struct {
 
 	// TokenType The type of the access token.
 	TokenType string `json:"token_type"`
+
+	// IssuedTokenType The type of the token issued using the token exchange grant.
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+
+	// AuthorizationDetails The authorization details granted for the access token, when they were requested.
+	AuthorizationDetails []AuthorizationDetail `json:"authorization_details,omitempty"`
+
+	// Expiry The time at which the access token expires. It is computed from ExpiresIn
+	// when the token is issued and is not part of the token endpoint response.
+	Expiry time.Time `json:"expiry"`
 }
 
 func NewTokenResponseWithOAuth2Token(t *oauth2.Token) *TokenResponse {
@@ -42,6 +67,7 @@ func NewTokenResponseWithOAuth2Token(t *oauth2.Token) *TokenResponse {
 		RefreshToken: t.RefreshToken,
 		ExpiresIn:    t.ExpiresIn,
 		TokenType:    t.TokenType,
+		Expiry:       t.Expiry,
 	}
 
 	if grantID, ok := t.Extra("grant_id").(string); ok {
@@ -56,5 +82,43 @@ func NewTokenResponseWithOAuth2Token(t *oauth2.Token) *TokenResponse {
 		tr.Scope = scope
 	}
 
+	if issuedTokenType, ok := t.Extra("issued_token_type").(string); ok {
+		tr.IssuedTokenType = issuedTokenType
+	}
+
+	if v := t.Extra("authorization_details"); v != nil {
+		// details that cannot be parsed are left out rather than failing the grant
+		tr.AuthorizationDetails, _ = parseAuthorizationDetails(v)
+	}
+
 	return tr
 }
+
+// OAuth2Token converts the token response to an oauth2.Token.
+func (t *TokenResponse) OAuth2Token() *oauth2.Token {
+	ot := &oauth2.Token{
+		AccessToken:  t.AccessToken,
+		TokenType:    t.TokenType,
+		RefreshToken: t.RefreshToken,
+		Expiry:       t.Expiry,
+		ExpiresIn:    t.ExpiresIn,
+	}
+
+	return ot.WithExtra(map[string]any{
+		"grant_id":              t.GrantID,
+		"id_token":              t.IDToken,
+		"scope":                 t.Scope,
+		"issued_token_type":     t.IssuedTokenType,
+		"authorization_details": t.AuthorizationDetails,
+	})
+}
+
+// expiresWithin reports whether the access token expires within the provided duration.
+// Tokens without a known expiry are treated as valid.
+func (t *TokenResponse) expiresWithin(d time.Duration) bool {
+	if t.Expiry.IsZero() {
+		return false
+	}
+
+	return time.Now().Add(d).After(t.Expiry)
+}
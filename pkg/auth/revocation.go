@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+// RevokeToken revokes the access or refresh token using the revocation endpoint described
+// in RFC 7009, authenticating with the configured ClientAuth. Revoking a refresh token
+// also invalidates the access tokens issued with the same grant.
+//
+// The tokenTypeHint is optional and is either TokenTypeHintAccessToken or TokenTypeHintRefreshToken.
+// Tokens that are already invalid are not treated as an error.
+func (c *Client) RevokeToken(ctx context.Context, token string, tokenTypeHint string) error {
+	if token == "" {
+		return errorsx.G11NError("'token' is required.")
+	}
+
+	params := url.Values{}
+	params.Set("token", token)
+	if tokenTypeHint != "" {
+		params.Set("token_type_hint", tokenTypeHint)
+	}
+
+	res, body, err := c.postForm(ctx, revocationEndpoint, params)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return newResponseError(res, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	"github.com/ibm-verify/verify-sdk-go/x/randx"
+)
+
+const (
+	// maxCookieSize is the largest cookie most browsers accept, including the name.
+	maxCookieSize = 4096
+
+	// maxCookieChunks is the number of cookies a value stored by CookieSessionStore can be
+	// split across, which keeps the Cookie header within the limits of most servers.
+	maxCookieChunks = 5
+)
+
+// SessionStore persists named values for a browser session, such as the state of a login in
+// progress and the authenticated session. Implementations are expected to protect the values
+// from being read or modified by the browser.
+type SessionStore interface {
+	// Load decodes the named value of the request into v. It returns false if there is no
+	// value or it has expired.
+	Load(r *http.Request, name string, v any) (bool, error)
+
+	// Save stores the value under the name for the browser session.
+	Save(w http.ResponseWriter, r *http.Request, name string, v any, opts *SessionOptions) error
+
+	// Delete removes the named value from the browser session.
+	Delete(w http.ResponseWriter, r *http.Request, name string) error
+}
+
+// SessionOptions controls how a value is stored by a SessionStore.
+type SessionOptions struct {
+	// MaxAge specifies how long the value is kept.
+	MaxAge time.Duration
+
+	// SameSite specifies the SameSite attribute of the cookie. By default, this is set to
+	// http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+// CookieSessionStore keeps the values in cookies encrypted using AES-GCM, so no server-side
+// storage is needed. Browsers limit cookies to about 4KB, so larger values are split across
+// several cookies named <name>.0, <name>.1 and so on. Values too large to fit in those need
+// to use MemorySessionStore or another server-side store instead.
+type CookieSessionStore struct {
+	// Path is the path attribute of the cookies. By default, this is set to "/".
+	Path string
+
+	// Insecure allows the cookies to be sent over plain HTTP, such as during local development.
+	Insecure bool
+
+	aead cipher.AEAD
+}
+
+// NewCookieSessionStore returns a CookieSessionStore that encrypts the values using the key,
+// which must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewCookieSessionStore(key []byte) (*CookieSessionStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errorsx.G11NError("unable to create the cipher; err=%v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errorsx.G11NError("unable to create the cipher; err=%v", err)
+	}
+
+	return &CookieSessionStore{
+		aead: aead,
+	}, nil
+}
+
+func (s *CookieSessionStore) Load(r *http.Request, name string, v any) (bool, error) {
+	encoded := s.cookieValue(r, name)
+	if encoded == "" {
+		return false, nil
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return false, nil
+	}
+
+	// the cookie name is authenticated so values cannot be swapped between cookies
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return false, nil
+	}
+
+	entry := &storedValue{}
+	if err := json.Unmarshal(plaintext, entry); err != nil {
+		return false, errorsx.G11NError("unable to parse the session; err=%v", err)
+	}
+
+	if time.Now().After(entry.Expiry) {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(entry.Value, v); err != nil {
+		return false, errorsx.G11NError("unable to parse the session; err=%v", err)
+	}
+
+	return true, nil
+}
+
+func (s *CookieSessionStore) Save(w http.ResponseWriter, r *http.Request, name string, v any, opts *SessionOptions) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return errorsx.G11NError("unable to encode the session; err=%v", err)
+	}
+
+	plaintext, err := json.Marshal(&storedValue{
+		Value:  value,
+		Expiry: time.Now().Add(opts.MaxAge),
+	})
+	if err != nil {
+		return errorsx.G11NError("unable to encode the session; err=%v", err)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(name))
+	encoded := base64.RawURLEncoding.EncodeToString(sealed)
+	cookie := newSessionCookie(name, encoded, s.Path, s.Insecure, opts)
+	if len(cookie.String()) <= maxCookieSize {
+		s.expireChunks(w, r, name, 0)
+		http.SetCookie(w, cookie)
+		return nil
+	}
+
+	// the chunk names all have the same length since there are fewer than 10 chunks
+	chunkSize := maxCookieSize - len(newSessionCookie(chunkCookieName(name, 0), "", s.Path, s.Insecure, opts).String())
+	chunks := (len(encoded) + chunkSize - 1) / chunkSize
+	if chunks > maxCookieChunks {
+		return errorsx.G11NError("the session is too large to be stored in cookies")
+	}
+
+	if _, err := r.Cookie(name); err == nil {
+		http.SetCookie(w, expiredSessionCookie(name, s.Path, s.Insecure))
+	}
+
+	for i := 0; i < chunks; i++ {
+		chunk := encoded[i*chunkSize : min((i+1)*chunkSize, len(encoded))]
+		http.SetCookie(w, newSessionCookie(chunkCookieName(name, i), chunk, s.Path, s.Insecure, opts))
+	}
+
+	s.expireChunks(w, r, name, chunks)
+	return nil
+}
+
+func (s *CookieSessionStore) Delete(w http.ResponseWriter, r *http.Request, name string) error {
+	http.SetCookie(w, expiredSessionCookie(name, s.Path, s.Insecure))
+	s.expireChunks(w, r, name, 0)
+	return nil
+}
+
+// cookieValue returns the value stored under the name, either in a single cookie or joined
+// from the chunks it was split across.
+func (s *CookieSessionStore) cookieValue(r *http.Request, name string) string {
+	if cookie, err := r.Cookie(name); err == nil {
+		return cookie.Value
+	}
+
+	var value strings.Builder
+	for i := 0; i < maxCookieChunks; i++ {
+		cookie, err := r.Cookie(chunkCookieName(name, i))
+		if err != nil {
+			break
+		}
+
+		value.WriteString(cookie.Value)
+	}
+
+	return value.String()
+}
+
+// expireChunks removes the chunks of the value sent with the request, starting at the index,
+// such as when the value is now stored in fewer cookies.
+func (s *CookieSessionStore) expireChunks(w http.ResponseWriter, r *http.Request, name string, from int) {
+	for i := from; i < maxCookieChunks; i++ {
+		if _, err := r.Cookie(chunkCookieName(name, i)); err == nil {
+			http.SetCookie(w, expiredSessionCookie(chunkCookieName(name, i), s.Path, s.Insecure))
+		}
+	}
+}
+
+func chunkCookieName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
+
+// MemorySessionStore keeps the values in memory and only sends a random session identifier in
+// the cookies. Values are lost when the process restarts and are not shared across instances.
+type MemorySessionStore struct {
+	// Path is the path attribute of the cookies. By default, this is set to "/".
+	Path string
+
+	// Insecure allows the cookies to be sent over plain HTTP, such as during local development.
+	Insecure bool
+
+	mu     sync.Mutex
+	values map[string]*storedValue
+}
+
+// NewMemorySessionStore returns an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		values: map[string]*storedValue{},
+	}
+}
+
+func (s *MemorySessionStore) Load(r *http.Request, name string, v any) (bool, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	entry, ok := s.values[name+"."+cookie.Value]
+	s.mu.Unlock()
+	if !ok || time.Now().After(entry.Expiry) {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(entry.Value, v); err != nil {
+		return false, errorsx.G11NError("unable to parse the session; err=%v", err)
+	}
+
+	return true, nil
+}
+
+func (s *MemorySessionStore) Save(w http.ResponseWriter, r *http.Request, name string, v any, opts *SessionOptions) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return errorsx.G11NError("unable to encode the session; err=%v", err)
+	}
+
+	id, err := randx.GenerateRandomString(43, randx.AlphaLower)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	// drop expired values so abandoned sessions do not accumulate
+	for k, entry := range s.values {
+		if now.After(entry.Expiry) {
+			delete(s.values, k)
+		}
+	}
+
+	// a new identifier is issued each time to prevent session fixation
+	if cookie, err := r.Cookie(name); err == nil {
+		delete(s.values, name+"."+cookie.Value)
+	}
+
+	s.values[name+"."+id] = &storedValue{Value: value, Expiry: now.Add(opts.MaxAge)}
+	s.mu.Unlock()
+
+	http.SetCookie(w, newSessionCookie(name, id, s.Path, s.Insecure, opts))
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(w http.ResponseWriter, r *http.Request, name string) error {
+	if cookie, err := r.Cookie(name); err == nil {
+		s.mu.Lock()
+		delete(s.values, name+"."+cookie.Value)
+		s.mu.Unlock()
+	}
+
+	http.SetCookie(w, expiredSessionCookie(name, s.Path, s.Insecure))
+	return nil
+}
+
+// storedValue is the encoded value kept by the session stores.
+type storedValue struct {
+	Value  json.RawMessage `json:"v"`
+	Expiry time.Time       `json:"exp"`
+}
+
+func newSessionCookie(name string, value string, path string, insecure bool, opts *SessionOptions) *http.Cookie {
+	if path == "" {
+		path = "/"
+	}
+
+	sameSite := opts.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(opts.MaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   !insecure,
+		SameSite: sameSite,
+	}
+}
+
+func expiredSessionCookie(name string, path string, insecure bool) *http.Cookie {
+	if path == "" {
+		path = "/"
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     path,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !insecure,
+	}
+}
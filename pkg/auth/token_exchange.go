@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+// TokenType identifies the type of a token in a token exchange, as described in RFC 8693.
+type TokenType string
+
+const (
+	// TokenTypeAccessToken indicates an OAuth 2.0 access token.
+	TokenTypeAccessToken TokenType = "urn:ietf:params:oauth:token-type:access_token"
+
+	// TokenTypeRefreshToken indicates an OAuth 2.0 refresh token.
+	TokenTypeRefreshToken TokenType = "urn:ietf:params:oauth:token-type:refresh_token"
+
+	// TokenTypeIDToken indicates an OpenID Connect ID token.
+	TokenTypeIDToken TokenType = "urn:ietf:params:oauth:token-type:id_token"
+
+	// TokenTypeJWT indicates a JSON Web Token.
+	TokenTypeJWT TokenType = "urn:ietf:params:oauth:token-type:jwt"
+
+	// TokenTypeSAML1 indicates a base64url-encoded SAML 1.1 assertion.
+	TokenTypeSAML1 TokenType = "urn:ietf:params:oauth:token-type:saml1"
+
+	// TokenTypeSAML2 indicates a base64url-encoded SAML 2.0 assertion.
+	TokenTypeSAML2 TokenType = "urn:ietf:params:oauth:token-type:saml2"
+
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// TokenExchangeRequest contains the parameters of a token exchange request.
+type TokenExchangeRequest struct {
+	// SubjectToken is the token that represents the identity of the party on behalf of
+	// whom the token is requested. This is required.
+	SubjectToken string
+
+	// SubjectTokenType is the type of the SubjectToken. This is required.
+	SubjectTokenType TokenType
+
+	// ActorToken optionally represents the identity of the acting party, such as the
+	// gateway, when requesting a delegated token.
+	ActorToken string
+
+	// ActorTokenType is the type of the ActorToken. It is required when ActorToken is set.
+	ActorTokenType TokenType
+
+	// Resources optionally contains the URIs of the target services where the issued token
+	// is intended to be used.
+	Resources []string
+
+	// Audiences optionally contains the logical names of the target services where the
+	// issued token is intended to be used.
+	Audiences []string
+
+	// RequestedTokenType optionally indicates the type of token requested. If not set, the
+	// authorization server decides the type, which is returned as IssuedTokenType.
+	RequestedTokenType TokenType
+
+	// Scopes optionally contains the scopes requested for the issued token. By default, the
+	// Scopes of the client are requested.
+	Scopes []string
+}
+
+// TokenWithTokenExchange exchanges the subject token, and optionally the actor token, for a
+// new token using the token exchange grant, as described in RFC 8693. The type of the issued
+// token is returned in TokenResponse.IssuedTokenType.
+func (c *Client) TokenWithTokenExchange(ctx context.Context, request *TokenExchangeRequest, parameters url.Values) (*TokenResponse, error) {
+	if request == nil || request.SubjectToken == "" {
+		return nil, errorsx.G11NError("'subjectToken' is required.")
+	}
+
+	if request.SubjectTokenType == "" {
+		return nil, errorsx.G11NError("'subjectTokenType' is required.")
+	}
+
+	params := url.Values{}
+	for k := range parameters {
+		params.Set(k, parameters.Get(k))
+	}
+
+	params.Set("grant_type", tokenExchangeGrantType)
+	params.Set("subject_token", request.SubjectToken)
+	params.Set("subject_token_type", string(request.SubjectTokenType))
+
+	if request.ActorToken != "" {
+		if request.ActorTokenType == "" {
+			return nil, errorsx.G11NError("'actorTokenType' is required when 'actorToken' is set.")
+		}
+
+		params.Set("actor_token", request.ActorToken)
+		params.Set("actor_token_type", string(request.ActorTokenType))
+	}
+
+	for _, resource := range request.Resources {
+		params.Add("resource", resource)
+	}
+
+	for _, audience := range request.Audiences {
+		params.Add("audience", audience)
+	}
+
+	if request.RequestedTokenType != "" {
+		params.Set("requested_token_type", string(request.RequestedTokenType))
+	}
+
+	scopes := request.Scopes
+	if len(scopes) == 0 {
+		scopes = c.Scopes
+	}
+
+	if len(scopes) > 0 {
+		params.Set("scope", strings.Join(scopes, " "))
+	}
+
+	return c.tokenRequest(ctx, params)
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultExpiryDelta is how early a cached token is refreshed before it expires.
+	DefaultExpiryDelta = 30 * time.Second
+)
+
+// TokenSource is a concurrency-safe oauth2.TokenSource that caches the current token
+// and refreshes it shortly before it expires.
+//
+// When the cached token has a refresh token, the refresh_token grant is used. Otherwise,
+// a new token is issued using the client credentials grant if ClientCredentials is set,
+// or an error is returned, so a user token is never replaced by a token for the client.
+// Concurrent callers that observe an expiring token wait for a single refresh rather than
+// each issuing a request.
+type TokenSource struct {
+	// ExpiryDelta determines how early the token is refreshed before it expires.
+	// By default, this is set to DefaultExpiryDelta.
+	ExpiryDelta time.Duration
+
+	// ClientCredentials determines whether a new token is issued using the client credentials
+	// grant when the token cannot be refreshed. It is set when the TokenSource starts
+	// without a token.
+	ClientCredentials bool
+
+	ctx        context.Context
+	client     *Client
+	parameters url.Values
+
+	// store, if set, persists the tokens under the key
+	store TokenStore
+	key   TokenStoreKey
+
+	mu    sync.Mutex
+	token *TokenResponse
+}
+
+// TokenSource returns a TokenSource that starts with the provided token. The token may be
+// nil, in which case the tokens are issued using the client credentials grant. The parameters
+// are sent as additional parameters when a token is issued with client credentials.
+func (c *Client) TokenSource(ctx context.Context, token *TokenResponse, parameters url.Values) *TokenSource {
+	return &TokenSource{
+		ExpiryDelta:       DefaultExpiryDelta,
+		ClientCredentials: token == nil,
+		ctx:               ctx,
+		client:            c,
+		parameters:        parameters,
+		token:             token,
+	}
+}
+
+// Token returns the cached token, refreshing it if it is about to expire.
+// It implements oauth2.TokenSource.
+func (ts *TokenSource) Token() (*oauth2.Token, error) {
+	t, err := ts.TokenResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.OAuth2Token(), nil
+}
+
+// TokenResponse returns the cached token response, refreshing it if it is about to expire.
+func (ts *TokenSource) TokenResponse() (*TokenResponse, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != nil && ts.token.AccessToken != "" && !ts.token.expiresWithin(ts.ExpiryDelta) {
+		return ts.token, nil
+	}
+
+	if ts.store != nil {
+		if locker, ok := ts.store.(LockingTokenStore); ok {
+			// the lock is held until the refreshed token is saved, so another process does
+			// not use the same refresh token
+			unlock, err := locker.Lock(ts.ctx, ts.key)
+			if err != nil {
+				return nil, err
+			}
+			defer unlock()
+		}
+
+		// another process may have already refreshed the token
+		stored, err := ts.store.Load(ts.ctx, ts.key)
+		if err != nil {
+			return nil, err
+		}
+
+		if stored != nil && stored.AccessToken != "" && !stored.expiresWithin(ts.ExpiryDelta) {
+			ts.token = stored
+			return stored, nil
+		}
+
+		if stored != nil {
+			ts.token = stored
+		}
+	}
+
+	t, err := ts.refresh()
+	if err != nil {
+		if ts.store != nil && errors.Is(err, ErrInvalidGrant) {
+			return ts.recoverInvalidGrant(err)
+		}
+
+		return nil, err
+	}
+
+	if ts.store != nil {
+		if err := ts.store.Save(ts.ctx, ts.key, t); err != nil {
+			return nil, err
+		}
+	}
+
+	ts.token = t
+	return t, nil
+}
+
+// HTTPClient returns an http.Client that adds the Authorization header using tokens
+// from this source. It can be supplied to the config clients. If DPoP is configured on
+// the client, a DPoP proof bound to the token is also added to each request. If a mutual-TLS
+// ClientAuth is configured, the client certificate is presented for certificate-bound tokens.
+// The Timeout, CheckRedirect and Jar of the http.Client in the context are preserved.
+func (ts *TokenSource) HTTPClient() (*http.Client, error) {
+	// resource requests carry the access token, as UserInfo requests do
+	hc, err := ts.client.httpClient(ts.ctx, userinfoEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := *hc
+	ret.Transport = &oauth2.Transport{
+		Source: ts,
+		Base:   hc.Transport,
+	}
+
+	return &ret, nil
+}
+
+// recoverInvalidGrant handles a rejected refresh token. If another process has saved a newer
+// token in the meantime, that token is used. Otherwise, the stored token is deleted since its
+// refresh token can no longer be used.
+func (ts *TokenSource) recoverInvalidGrant(grantErr error) (*TokenResponse, error) {
+	rejected := ""
+	if ts.token != nil {
+		rejected = ts.token.RefreshToken
+	}
+
+	stored, err := ts.store.Load(ts.ctx, ts.key)
+	if err != nil || stored == nil {
+		return nil, grantErr
+	}
+
+	if stored.RefreshToken == rejected {
+		_ = ts.store.Delete(ts.ctx, ts.key)
+		return nil, grantErr
+	}
+
+	ts.token = stored
+	if stored.AccessToken != "" && !stored.expiresWithin(ts.ExpiryDelta) {
+		return stored, nil
+	}
+
+	return nil, grantErr
+}
+
+func (ts *TokenSource) refresh() (*TokenResponse, error) {
+	if ts.token == nil || ts.token.RefreshToken == "" {
+		if !ts.ClientCredentials {
+			return nil, errorsx.G11NError("the token cannot be refreshed because it does not contain a refresh token")
+		}
+
+		return ts.client.TokenWithAPIClient(ts.ctx, ts.parameters)
+	}
+
+	return ts.client.TokenWithRefreshToken(ts.ctx, ts.token.RefreshToken, nil)
+}
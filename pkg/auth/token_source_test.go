@@ -0,0 +1,299 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
+)
+
+type TokenSourceTestSuite struct {
+	suite.Suite
+
+	ctx      context.Context
+	server   *httptest.Server
+	client   *auth.Client
+	requests atomic.Int32
+	grants   []string
+	mu       sync.Mutex
+
+	// refreshTokens, if set, contains the refresh tokens that can be used. Each refresh token
+	// is rotated on use, and using it again is rejected with invalid_grant.
+	refreshTokens map[string]bool
+}
+
+func (s *TokenSourceTestSuite) SetupTest() {
+	s.requests.Store(0)
+	s.grants = nil
+	s.refreshTokens = nil
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		n := s.requests.Add(1)
+		s.mu.Lock()
+		s.grants = append(s.grants, r.PostForm.Get("grant_type"))
+		refreshToken := "refresh"
+		if s.refreshTokens != nil {
+			if !s.refreshTokens[r.PostForm.Get("refresh_token")] {
+				s.mu.Unlock()
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+				return
+			}
+
+			delete(s.refreshTokens, r.PostForm.Get("refresh_token"))
+			refreshToken = "refresh" + strings.Repeat("x", int(n))
+			s.refreshTokens[refreshToken] = true
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access" + strings.Repeat("x", int(n)),
+			"refresh_token": refreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    7200,
+		})
+	}))
+
+	s.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, s.server.Client())
+	s.client = &auth.Client{
+		Tenant: strings.TrimPrefix(s.server.URL, "https://"),
+		ClientAuth: &auth.ClientSecretPost{
+			ClientID:     "clientID",
+			ClientSecret: "clientSecret",
+		},
+	}
+}
+
+func (s *TokenSourceTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *TokenSourceTestSuite) TestCachesToken() {
+	ts := s.client.TokenSource(s.ctx, nil, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ts.Token()
+			require.NoError(s.T(), err, "unable to get a token")
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(s.T(), 1, s.requests.Load(), "concurrent calls should issue a single token request")
+	require.Equal(s.T(), []string{"client_credentials"}, s.grants)
+}
+
+func (s *TokenSourceTestSuite) TestRefreshesExpiringToken() {
+	ts := s.client.TokenSource(s.ctx, &auth.TokenResponse{
+		AccessToken:  "expiring",
+		RefreshToken: "refresh",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(10 * time.Second),
+	}, nil)
+
+	t, err := ts.Token()
+	require.NoError(s.T(), err, "unable to refresh the token")
+	require.NotEqual(s.T(), "expiring", t.AccessToken)
+	require.Equal(s.T(), []string{"refresh_token"}, s.grants)
+}
+
+func (s *TokenSourceTestSuite) TestExpiringTokenWithoutRefreshToken() {
+	ts := s.client.TokenSource(s.ctx, &auth.TokenResponse{
+		AccessToken: "user",
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(10 * time.Second),
+	}, nil)
+
+	_, err := ts.Token()
+	require.Error(s.T(), err, "the user token must not be replaced by a client token")
+	require.Empty(s.T(), s.grants)
+
+	ts.ClientCredentials = true
+	t, err := ts.Token()
+	require.NoError(s.T(), err, "unable to get a token using client credentials")
+	require.NotEqual(s.T(), "user", t.AccessToken)
+	require.Equal(s.T(), []string{"client_credentials"}, s.grants)
+}
+
+func (s *TokenSourceTestSuite) TestHTTPClient() {
+	base := s.server.Client()
+	base.Timeout = 5 * time.Second
+	ts := s.client.TokenSource(context.WithValue(s.ctx, oauth2.HTTPClient, base), nil, nil)
+
+	hc, err := ts.HTTPClient()
+	require.NoError(s.T(), err, "unable to create the http.Client")
+	require.Equal(s.T(), 5*time.Second, hc.Timeout)
+
+	res, err := hc.Get(s.server.URL + "/resource")
+	require.NoError(s.T(), err, "unable to call the resource")
+	res.Body.Close()
+
+	// the certificate cannot be added to a custom transport, so no unbound client is returned
+	s.client.ClientAuth = &auth.TLSClientAuth{ClientID: "clientID"}
+	ts = s.client.TokenSource(context.WithValue(s.ctx, oauth2.HTTPClient, &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)}), nil, nil)
+	_, err = ts.HTTPClient()
+	require.Error(s.T(), err, "the certificate error should be returned")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func (s *TokenSourceTestSuite) TestTokenSourceWithStore() {
+	store := auth.NewMemoryTokenStore()
+	key, err := s.client.TokenStoreKey("work")
+	require.NoError(s.T(), err, "unable to get the key")
+	require.Equal(s.T(), "clientID", key.ClientID)
+
+	require.NoError(s.T(), store.Save(s.ctx, key, &auth.TokenResponse{
+		AccessToken:  "expired",
+		RefreshToken: "stored",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Minute),
+	}), "unable to save the token")
+
+	ts, err := s.client.TokenSourceWithStore(s.ctx, store, "work", nil)
+	require.NoError(s.T(), err, "unable to create the token source")
+	t, err := ts.Token()
+	require.NoError(s.T(), err, "unable to refresh the token")
+	require.Equal(s.T(), []string{"refresh_token"}, s.grants)
+
+	stored, err := store.Load(s.ctx, key)
+	require.NoError(s.T(), err, "unable to load the token")
+	require.Equal(s.T(), t.AccessToken, stored.AccessToken, "the refreshed token should be saved")
+
+	// a token saved by another process is used instead of refreshing again
+	ts, err = s.client.TokenSourceWithStore(s.ctx, store, "work", nil)
+	require.NoError(s.T(), err, "unable to create the token source")
+	_, err = ts.Token()
+	require.NoError(s.T(), err, "unable to get the token")
+	require.Len(s.T(), s.grants, 1)
+}
+
+func (s *TokenSourceTestSuite) TestConcurrentRefreshWithRotation() {
+	s.refreshTokens = map[string]bool{"stored": true}
+	path := filepath.Join(s.T().TempDir(), "tokens.json")
+	storeKey := []byte(strings.Repeat("k", 32))
+
+	store, err := auth.NewFileTokenStore(path, storeKey)
+	require.NoError(s.T(), err, "unable to create the token store")
+	key, err := s.client.TokenStoreKey("work")
+	require.NoError(s.T(), err, "unable to get the key")
+	require.NoError(s.T(), store.Save(s.ctx, key, &auth.TokenResponse{
+		AccessToken:  "expired",
+		RefreshToken: "stored",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Minute),
+	}), "unable to save the token")
+
+	// each token source uses its own store, standing in for separate processes
+	var sources []*auth.TokenSource
+	for i := 0; i < 2; i++ {
+		store, err := auth.NewFileTokenStore(path, storeKey)
+		require.NoError(s.T(), err, "unable to create the token store")
+		ts, err := s.client.TokenSourceWithStore(s.ctx, store, "work", nil)
+		require.NoError(s.T(), err, "unable to create the token source")
+		sources = append(sources, ts)
+	}
+
+	tokens := make([]*oauth2.Token, len(sources))
+	var wg sync.WaitGroup
+	for i, ts := range sources {
+		wg.Add(1)
+		go func(i int, ts *auth.TokenSource) {
+			defer wg.Done()
+			t, err := ts.Token()
+			require.NoError(s.T(), err, "unable to get the token")
+			tokens[i] = t
+		}(i, ts)
+	}
+	wg.Wait()
+
+	require.Equal(s.T(), []string{"refresh_token"}, s.grants, "the token should be refreshed once")
+	require.Equal(s.T(), tokens[0].AccessToken, tokens[1].AccessToken)
+
+	stored, err := store.Load(s.ctx, key)
+	require.NoError(s.T(), err, "unable to load the token")
+	require.NotNil(s.T(), stored, "the refreshed token should be kept")
+	require.True(s.T(), s.refreshTokens[stored.RefreshToken], "the rotated refresh token should be saved")
+}
+
+// staleTokenStore returns the token it was created with from its first Load, as if another
+// process had saved a newer token after it was loaded. It does not implement LockingTokenStore.
+type staleTokenStore struct {
+	auth.TokenStore
+
+	stale *auth.TokenResponse
+}
+
+func (s *staleTokenStore) Load(ctx context.Context, key auth.TokenStoreKey) (*auth.TokenResponse, error) {
+	if stale := s.stale; stale != nil {
+		s.stale = nil
+		return stale, nil
+	}
+
+	return s.TokenStore.Load(ctx, key)
+}
+
+func (s *TokenSourceTestSuite) TestInvalidGrantKeepsNewerToken() {
+	s.refreshTokens = map[string]bool{"stored": true}
+	store := auth.NewMemoryTokenStore()
+	key, err := s.client.TokenStoreKey("work")
+	require.NoError(s.T(), err, "unable to get the key")
+
+	expired := &auth.TokenResponse{
+		AccessToken:  "expired",
+		RefreshToken: "stored",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+	require.NoError(s.T(), store.Save(s.ctx, key, expired), "unable to save the token")
+
+	first, err := s.client.TokenSourceWithStore(s.ctx, store, "work", nil)
+	require.NoError(s.T(), err, "unable to create the token source")
+	refreshed, err := first.Token()
+	require.NoError(s.T(), err, "unable to refresh the token")
+
+	// the second token source refreshes using the refresh token that has just been rotated
+	second, err := s.client.TokenSourceWithStore(s.ctx, &staleTokenStore{TokenStore: store, stale: expired}, "work", nil)
+	require.NoError(s.T(), err, "unable to create the token source")
+	t, err := second.Token()
+	require.NoError(s.T(), err, "the token saved by the other source should be used")
+	require.Equal(s.T(), refreshed.AccessToken, t.AccessToken)
+
+	stored, err := store.Load(s.ctx, key)
+	require.NoError(s.T(), err, "unable to load the token")
+	require.NotNil(s.T(), stored, "the newer token must not be deleted")
+
+	// a refresh token that is still stored when it is rejected is deleted
+	s.refreshTokens = map[string]bool{}
+	require.NoError(s.T(), store.Save(s.ctx, key, &auth.TokenResponse{AccessToken: "expired", RefreshToken: stored.RefreshToken, Expiry: time.Now().Add(-time.Minute)}))
+	third, err := s.client.TokenSourceWithStore(s.ctx, store, "work", nil)
+	require.NoError(s.T(), err, "unable to create the token source")
+	_, err = third.Token()
+	require.ErrorIs(s.T(), err, auth.ErrInvalidGrant)
+
+	stored, err = store.Load(s.ctx, key)
+	require.NoError(s.T(), err, "unable to load the token")
+	require.Nil(s.T(), stored, "the rejected token should be deleted")
+}
+
+func TestTokenSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenSourceTestSuite))
+}
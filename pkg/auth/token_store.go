@@ -0,0 +1,527 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+)
+
+const (
+	// DefaultTokenProfile is the profile name used when none is specified.
+	DefaultTokenProfile = "default"
+
+	// tokenFileVersion is the version of the format of the token file.
+	tokenFileVersion = 1
+
+	// lockRetryInterval is how often a lock file held by another process is checked again.
+	lockRetryInterval = 50 * time.Millisecond
+
+	// defaultLockStaleAge is how long a lock file can go without being refreshed before it is
+	// assumed to be left behind by a process that exited without removing it.
+	defaultLockStaleAge = 30 * time.Second
+)
+
+// TokenStoreKey identifies a token kept by a TokenStore. A client can keep several tokens
+// for the same tenant, such as for different users, using different profiles.
+type TokenStoreKey struct {
+	// Tenant is the hostname of the tenant that issued the token.
+	Tenant string
+
+	// ClientID is the client_id of the client the token was issued to.
+	ClientID string
+
+	// Profile is the name of the profile. By default, this is set to DefaultTokenProfile.
+	Profile string
+}
+
+// String returns the key in the form tenant/clientID/profile.
+func (k TokenStoreKey) String() string {
+	profile := k.Profile
+	if profile == "" {
+		profile = DefaultTokenProfile
+	}
+
+	return k.Tenant + "/" + k.ClientID + "/" + profile
+}
+
+// TokenStore persists token responses between runs of an application, such as a CLI.
+type TokenStore interface {
+	// Load returns the token stored under the key, or nil if there is none.
+	Load(ctx context.Context, key TokenStoreKey) (*TokenResponse, error)
+
+	// Save stores the token under the key, replacing any existing token.
+	Save(ctx context.Context, key TokenStoreKey, token *TokenResponse) error
+
+	// Delete removes the token stored under the key, if any.
+	Delete(ctx context.Context, key TokenStoreKey) error
+}
+
+// LockingTokenStore is implemented by TokenStores that can be shared by several TokenSources,
+// such as by concurrent processes. A TokenSource holds the lock across loading, refreshing and
+// saving the token, so only one of them uses a refresh token that is rotated on each use.
+type LockingTokenStore interface {
+	TokenStore
+
+	// Lock waits until the lock for the key is acquired and returns the function that
+	// releases it. Load, Save and Delete can be called while the lock is held.
+	Lock(ctx context.Context, key TokenStoreKey) (func(), error)
+}
+
+// TokenStoreKey returns the key of the tokens issued to the client for the profile.
+func (c *Client) TokenStoreKey(profile string) (TokenStoreKey, error) {
+	if c.ClientAuth == nil {
+		return TokenStoreKey{}, errorsx.G11NError("'ClientAuth' is required.")
+	}
+
+	clientParams, err := c.ClientAuth.GetParameters()
+	if err != nil {
+		return TokenStoreKey{}, err
+	}
+
+	return TokenStoreKey{
+		Tenant:   c.Tenant,
+		ClientID: clientParams.Get("client_id"),
+		Profile:  profile,
+	}, nil
+}
+
+// TokenSourceWithStore returns a TokenSource that starts with the token stored for the profile
+// and saves each token it obtains, so a refreshed or rotated token is available the next time
+// the application runs. Before refreshing, the store is checked for a token saved by another
+// process. If the store implements LockingTokenStore, it is locked while the token is refreshed.
+// If the refresh token is rejected and the store still holds it, the stored token is deleted.
+func (c *Client) TokenSourceWithStore(ctx context.Context, store TokenStore, profile string, parameters url.Values) (*TokenSource, error) {
+	if store == nil {
+		return nil, errorsx.G11NError("'store' is required.")
+	}
+
+	key, err := c.TokenStoreKey(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := store.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := c.TokenSource(ctx, token, parameters)
+	ts.store = store
+	ts.key = key
+	return ts, nil
+}
+
+// MemoryTokenStore keeps the tokens in memory. It is useful for tests and for long-running
+// processes that do not need the tokens to survive a restart.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*TokenResponse
+	locks  map[string]chan struct{}
+}
+
+// NewMemoryTokenStore returns an empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: map[string]*TokenResponse{},
+		locks:  map[string]chan struct{}{},
+	}
+}
+
+// Lock acquires the lock for the key. It implements LockingTokenStore.
+func (s *MemoryTokenStore) Lock(ctx context.Context, key TokenStoreKey) (func(), error) {
+	s.mu.Lock()
+	lock, ok := s.locks[key.String()]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		s.locks[key.String()] = lock
+	}
+	s.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *MemoryTokenStore) Load(ctx context.Context, key TokenStoreKey) (*TokenResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[key.String()]
+	if !ok {
+		return nil, nil
+	}
+
+	// a copy is returned so callers cannot modify the stored token
+	copied := *token
+	return &copied, nil
+}
+
+func (s *MemoryTokenStore) Save(ctx context.Context, key TokenStoreKey, token *TokenResponse) error {
+	if token == nil {
+		return errorsx.G11NError("'token' is required.")
+	}
+
+	copied := *token
+	setTokenExpiry(&copied)
+
+	s.mu.Lock()
+	s.tokens[key.String()] = &copied
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryTokenStore) Delete(ctx context.Context, key TokenStoreKey) error {
+	s.mu.Lock()
+	delete(s.tokens, key.String())
+	s.mu.Unlock()
+	return nil
+}
+
+// FileTokenStore keeps the tokens in a file, encrypted using AES-GCM. Each token is encrypted
+// separately and bound to its key, so tokens cannot be swapped between profiles. The file can
+// be shared by concurrent processes, which take turns using a lock file next to it. Refreshes
+// are serialized across processes using a lock file for each key.
+type FileTokenStore struct {
+	// Path is the path of the token file. It is created, along with its directory, when the
+	// first token is saved.
+	Path string
+
+	// LockTimeout is how long to wait for another process to release the lock file.
+	// By default, this is set to 10 seconds.
+	LockTimeout time.Duration
+
+	// LockStaleAge is how long a lock file can go without being refreshed by the process
+	// holding it before it is removed by another process. A held lock file is refreshed
+	// several times within this period. By default, this is set to 30 seconds.
+	LockStaleAge time.Duration
+
+	aead cipher.AEAD
+}
+
+// NewFileTokenStore returns a FileTokenStore that encrypts the tokens using the key, which must
+// be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewFileTokenStore(path string, key []byte) (*FileTokenStore, error) {
+	if path == "" {
+		return nil, errorsx.G11NError("'path' is required.")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errorsx.G11NError("unable to create the cipher; err=%v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errorsx.G11NError("unable to create the cipher; err=%v", err)
+	}
+
+	return &FileTokenStore{
+		Path:        path,
+		LockTimeout: 10 * time.Second,
+		aead:        aead,
+	}, nil
+}
+
+// tokenFile is the content of the file of a FileTokenStore.
+type tokenFile struct {
+	Version int `json:"version"`
+
+	// Tokens contains the encrypted tokens by key.
+	Tokens map[string]string `json:"tokens"`
+}
+
+// Lock acquires the lock file of the key. It implements LockingTokenStore. The lock is
+// separate from the lock of the token file, so the token can be loaded and saved while it
+// is held.
+func (s *FileTokenStore) Lock(ctx context.Context, key TokenStoreKey) (func(), error) {
+	sum := sha256.Sum256([]byte(key.String()))
+	return s.lock(ctx, s.Path+"."+hex.EncodeToString(sum[:8])+".lock")
+}
+
+func (s *FileTokenStore) Load(ctx context.Context, key TokenStoreKey) (*TokenResponse, error) {
+	var token *TokenResponse
+	err := s.withLock(ctx, func() error {
+		f, err := s.read()
+		if err != nil {
+			return err
+		}
+
+		sealed, ok := f.Tokens[key.String()]
+		if !ok {
+			return nil
+		}
+
+		token, err = s.open(key, sealed)
+		return err
+	})
+
+	return token, err
+}
+
+func (s *FileTokenStore) Save(ctx context.Context, key TokenStoreKey, token *TokenResponse) error {
+	if token == nil {
+		return errorsx.G11NError("'token' is required.")
+	}
+
+	copied := *token
+	setTokenExpiry(&copied)
+
+	return s.withLock(ctx, func() error {
+		f, err := s.read()
+		if err != nil {
+			return err
+		}
+
+		sealed, err := s.seal(key, &copied)
+		if err != nil {
+			return err
+		}
+
+		f.Tokens[key.String()] = sealed
+		return s.write(f)
+	})
+}
+
+func (s *FileTokenStore) Delete(ctx context.Context, key TokenStoreKey) error {
+	return s.withLock(ctx, func() error {
+		f, err := s.read()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := f.Tokens[key.String()]; !ok {
+			return nil
+		}
+
+		delete(f.Tokens, key.String())
+		return s.write(f)
+	})
+}
+
+func (s *FileTokenStore) seal(key TokenStoreKey, token *TokenResponse) (string, error) {
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return "", errorsx.G11NError("unable to encode the token; err=%v", err)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// the key is authenticated so tokens cannot be swapped between profiles
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, plaintext, []byte(key.String()))), nil
+}
+
+func (s *FileTokenStore) open(key TokenStoreKey, value string) (*TokenResponse, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, errorsx.G11NError("the stored token for '%s' is invalid", key.String())
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(key.String()))
+	if err != nil {
+		return nil, errorsx.G11NError("unable to decrypt the stored token for '%s'; err=%v", key.String(), err)
+	}
+
+	token := &TokenResponse{}
+	if err := json.Unmarshal(plaintext, token); err != nil {
+		return nil, errorsx.G11NError("unable to parse the stored token; err=%v", err)
+	}
+
+	return token, nil
+}
+
+// read returns the content of the token file, or an empty file if it does not exist.
+func (s *FileTokenStore) read() (*tokenFile, error) {
+	f := &tokenFile{Version: tokenFileVersion, Tokens: map[string]string{}}
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return nil, errorsx.G11NError("unable to read the token file; err=%v", err)
+	}
+
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, errorsx.G11NError("unable to parse the token file; err=%v", err)
+	}
+
+	if f.Version != tokenFileVersion {
+		return nil, errorsx.G11NError("the token file version '%d' is not supported", f.Version)
+	}
+
+	if f.Tokens == nil {
+		f.Tokens = map[string]string{}
+	}
+
+	return f, nil
+}
+
+// write replaces the token file, so readers never observe a partially written file.
+func (s *FileTokenStore) write(f *tokenFile) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return errorsx.G11NError("unable to encode the token file; err=%v", err)
+	}
+
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errorsx.G11NError("unable to create the token directory; err=%v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return errorsx.G11NError("unable to write the token file; err=%v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errorsx.G11NError("unable to write the token file; err=%v", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errorsx.G11NError("unable to write the token file; err=%v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return errorsx.G11NError("unable to write the token file; err=%v", err)
+	}
+
+	return nil
+}
+
+// withLock calls fn while holding the lock of the token file.
+func (s *FileTokenStore) withLock(ctx context.Context, fn func() error) error {
+	unlock, err := s.lock(ctx, s.Path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fn()
+}
+
+// lock acquires the lock file, which is created exclusively so only one process can hold it at
+// a time, and returns the function that removes it. The lock file contains a random owner
+// token and its modification time is refreshed while it is held, so a lock held for longer
+// than the stale age is not taken over by another process, and a lock that has been taken
+// over is not removed by its previous owner.
+func (s *FileTokenStore) lock(ctx context.Context, lockPath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, errorsx.G11NError("unable to create the token directory; err=%v", err)
+	}
+
+	timeout := s.LockTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	staleAge := s.LockStaleAge
+	if staleAge <= 0 {
+		staleAge = defaultLockStaleAge
+	}
+
+	ownerBytes := make([]byte, 16)
+	if _, err := rand.Read(ownerBytes); err != nil {
+		return nil, errorsx.G11NError("unable to generate the lock owner; err=%v", err)
+	}
+	owner := hex.EncodeToString(ownerBytes)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = lock.WriteString(owner)
+			_ = lock.Close()
+			if err != nil {
+				_ = os.Remove(lockPath)
+				return nil, errorsx.G11NError("unable to lock the token file; err=%v", err)
+			}
+
+			break
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, errorsx.G11NError("unable to lock the token file; err=%v", err)
+		}
+
+		// a lock left behind by a process that exited is removed, unless it has been replaced
+		// in the meantime
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleAge {
+			stale, _ := os.ReadFile(lockPath)
+			removeLockFile(lockPath, string(stale))
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errorsx.G11NError("timed out waiting for the token file lock '%s'", lockPath)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	// the lock file is refreshed until it is released, so it is not mistaken for a stale lock
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(staleAge / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				_ = os.Chtimes(lockPath, now, now)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+			removeLockFile(lockPath, owner)
+		})
+	}, nil
+}
+
+// removeLockFile removes the lock file if it still contains the owner token.
+func removeLockFile(lockPath string, owner string) {
+	if current, err := os.ReadFile(lockPath); err == nil && string(current) == owner {
+		_ = os.Remove(lockPath)
+	}
+}
+
+// setTokenExpiry computes the expiry of the token from expires_in, if it is not already set,
+// so the stored token can be checked without knowing when it was issued.
+func setTokenExpiry(token *TokenResponse) {
+	if token.Expiry.IsZero() && token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+}
@@ -0,0 +1,152 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ibm-verify/verify-sdk-go/pkg/auth"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenStoreTestSuite struct {
+	suite.Suite
+
+	ctx  context.Context
+	path string
+	key  []byte
+}
+
+func (s *TokenStoreTestSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.path = filepath.Join(s.T().TempDir(), "verify", "tokens.json")
+	s.key = []byte(strings.Repeat("k", 32))
+}
+
+func (s *TokenStoreTestSuite) TestFileTokenStore() {
+	store, err := auth.NewFileTokenStore(s.path, s.key)
+	require.NoError(s.T(), err, "unable to create the token store")
+
+	work := auth.TokenStoreKey{Tenant: "tenant.verify.ibm.com", ClientID: "clientID", Profile: "work"}
+	personal := auth.TokenStoreKey{Tenant: "tenant.verify.ibm.com", ClientID: "clientID", Profile: "personal"}
+
+	t, err := store.Load(s.ctx, work)
+	require.NoError(s.T(), err, "unable to load from an empty store")
+	require.Nil(s.T(), t)
+
+	require.NoError(s.T(), store.Save(s.ctx, work, &auth.TokenResponse{AccessToken: "workAccessToken", ExpiresIn: 3600}), "unable to save the token")
+	require.NoError(s.T(), store.Save(s.ctx, personal, &auth.TokenResponse{AccessToken: "personal"}), "unable to save the token")
+
+	data, err := os.ReadFile(s.path)
+	require.NoError(s.T(), err, "unable to read the token file")
+	require.NotContains(s.T(), string(data), "workAccessToken", "the tokens must be encrypted")
+
+	info, err := os.Stat(s.path)
+	require.NoError(s.T(), err, "unable to stat the token file")
+	require.Equal(s.T(), os.FileMode(0600), info.Mode().Perm())
+
+	// a new instance, such as in the next run, reads the same tokens
+	store, err = auth.NewFileTokenStore(s.path, s.key)
+	require.NoError(s.T(), err, "unable to create the token store")
+	t, err = store.Load(s.ctx, work)
+	require.NoError(s.T(), err, "unable to load the token")
+	require.Equal(s.T(), "workAccessToken", t.AccessToken)
+	require.WithinDuration(s.T(), time.Now().Add(time.Hour), t.Expiry, time.Minute, "the expiry should be recorded")
+
+	require.NoError(s.T(), store.Delete(s.ctx, work), "unable to delete the token")
+	t, err = store.Load(s.ctx, work)
+	require.NoError(s.T(), err, "unable to load the token")
+	require.Nil(s.T(), t)
+
+	t, err = store.Load(s.ctx, personal)
+	require.NoError(s.T(), err, "unable to load the token")
+	require.Equal(s.T(), "personal", t.AccessToken)
+
+	other, err := auth.NewFileTokenStore(s.path, []byte(strings.Repeat("x", 32)))
+	require.NoError(s.T(), err, "unable to create the token store")
+	_, err = other.Load(s.ctx, personal)
+	require.Error(s.T(), err, "a different key should not decrypt the token")
+}
+
+func (s *TokenStoreTestSuite) TestFileTokenStoreConcurrentSaves() {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each store stands in for a separate process sharing the file
+			store, err := auth.NewFileTokenStore(s.path, s.key)
+			require.NoError(s.T(), err, "unable to create the token store")
+			key := auth.TokenStoreKey{Tenant: "tenant", ClientID: "clientID", Profile: string(rune('a' + i))}
+			require.NoError(s.T(), store.Save(s.ctx, key, &auth.TokenResponse{AccessToken: key.Profile}), "unable to save the token")
+		}(i)
+	}
+	wg.Wait()
+
+	store, err := auth.NewFileTokenStore(s.path, s.key)
+	require.NoError(s.T(), err, "unable to create the token store")
+	for i := 0; i < 10; i++ {
+		key := auth.TokenStoreKey{Tenant: "tenant", ClientID: "clientID", Profile: string(rune('a' + i))}
+		t, err := store.Load(s.ctx, key)
+		require.NoError(s.T(), err, "unable to load the token")
+		require.NotNil(s.T(), t, "the token for %s was lost", key.Profile)
+	}
+
+	_, err = os.Stat(s.path + ".lock")
+	require.ErrorIs(s.T(), err, os.ErrNotExist, "the lock file should be removed")
+}
+
+func (s *TokenStoreTestSuite) TestFileTokenStoreLockTimeout() {
+	store, err := auth.NewFileTokenStore(s.path, s.key)
+	require.NoError(s.T(), err, "unable to create the token store")
+	store.LockTimeout = 100 * time.Millisecond
+
+	require.NoError(s.T(), os.MkdirAll(filepath.Dir(s.path), 0700))
+	require.NoError(s.T(), os.WriteFile(s.path+".lock", nil, 0600))
+
+	_, err = store.Load(s.ctx, auth.TokenStoreKey{Tenant: "tenant", ClientID: "clientID"})
+	require.Error(s.T(), err, "the lock should time out")
+}
+
+func (s *TokenStoreTestSuite) TestFileTokenStoreLockHeldPastStaleAge() {
+	key := auth.TokenStoreKey{Tenant: "tenant", ClientID: "clientID"}
+	var stores []*auth.FileTokenStore
+	for i := 0; i < 2; i++ {
+		store, err := auth.NewFileTokenStore(s.path, s.key)
+		require.NoError(s.T(), err, "unable to create the token store")
+		store.LockStaleAge = 150 * time.Millisecond
+		store.LockTimeout = 300 * time.Millisecond
+		stores = append(stores, store)
+	}
+
+	unlock, err := stores[0].Lock(s.ctx, key)
+	require.NoError(s.T(), err, "unable to acquire the lock")
+
+	// the lock is held for longer than the stale age, and is refreshed in the meantime
+	time.Sleep(400 * time.Millisecond)
+	_, err = stores[1].Lock(s.ctx, key)
+	require.Error(s.T(), err, "a held lock must not be taken over")
+
+	unlock()
+	unlock, err = stores[1].Lock(s.ctx, key)
+	require.NoError(s.T(), err, "the released lock should be acquired")
+
+	// a lock that has been taken over by another process is not removed by its previous owner
+	sum := sha256.Sum256([]byte(key.String()))
+	lockPath := s.path + "." + hex.EncodeToString(sum[:8]) + ".lock"
+	require.NoError(s.T(), os.WriteFile(lockPath, []byte("other"), 0600))
+	unlock()
+	_, err = os.Stat(lockPath)
+	require.NoError(s.T(), err, "the lock of the other process should be kept")
+}
+
+func TestTokenStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenStoreTestSuite))
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	errorsx "github.com/ibm-verify/verify-sdk-go/pkg/core/errors"
+	typesx "github.com/ibm-verify/verify-sdk-go/x/types"
+)
+
+var (
+	// defaultKeyEncryptionAlgorithms lists the JWE alg values accepted when the discovery
+	// document does not advertise any.
+	defaultKeyEncryptionAlgorithms = []jose.KeyAlgorithm{
+		jose.RSA_OAEP, jose.RSA_OAEP_256,
+		jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW,
+	}
+
+	// defaultContentEncryptionAlgorithms lists the JWE enc values accepted when the discovery
+	// document does not advertise any.
+	defaultContentEncryptionAlgorithms = []jose.ContentEncryption{
+		jose.A128GCM, jose.A192GCM, jose.A256GCM,
+		jose.A128CBC_HS256, jose.A192CBC_HS384, jose.A256CBC_HS512,
+	}
+)
+
+// UserInfo contains the claims returned by the UserInfo endpoint.
+type UserInfo struct {
+	typesx.Map
+}
+
+// Subject returns the sub claim, which identifies the user.
+func (u *UserInfo) Subject() string {
+	return u.SafeString("sub", "")
+}
+
+// Email returns the email claim.
+func (u *UserInfo) Email() string {
+	return u.SafeString("email", "")
+}
+
+// Name returns the name claim.
+func (u *UserInfo) Name() string {
+	return u.SafeString("name", "")
+}
+
+// UserInfoWithTokenResponse calls the UserInfo endpoint using the access token in the token response.
+func (c *Client) UserInfoWithTokenResponse(ctx context.Context, tokenResponse *TokenResponse) (*UserInfo, error) {
+	if tokenResponse == nil {
+		return nil, errorsx.G11NError("'tokenResponse' is required.")
+	}
+
+	return c.UserInfo(ctx, tokenResponse.AccessToken)
+}
+
+// UserInfo calls the UserInfo endpoint using the access token and returns the claims.
+//
+// Plain JSON, signed (JWS), encrypted (JWE) and nested signed and encrypted responses are
+// supported. Signed responses are verified using the tenant keys and encrypted responses are
+// decrypted using DecryptionKey. When UserInfoSignedResponseAlg is set, responses that are not
+// signed using the algorithm are rejected. When DecryptionKey is set, responses that are not
+// encrypted are rejected.
+func (c *Client) UserInfo(ctx context.Context, accessToken string) (*UserInfo, error) {
+	if accessToken == "" {
+		return nil, errorsx.G11NError("'accessToken' is required.")
+	}
+
+	endpointURL, err := c.endpoint(ctx, userinfoEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json, application/jwt")
+
+	hc, err := c.httpClient(ctx, userinfoEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.DPoP != nil {
+		// the DPoP transport adds the proof bound to the access token
+		req.Header.Set("Authorization", "DPoP "+accessToken)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, errorsx.G11NError("unable to read the response; err=%v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newResponseError(res, body)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "application/jwt" {
+		if c.DecryptionKey != nil {
+			return nil, errorsx.G11NError("the UserInfo response must be encrypted")
+		}
+
+		if c.UserInfoSignedResponseAlg != "" {
+			return nil, errorsx.G11NError("the UserInfo response must be signed")
+		}
+
+		claims := typesx.Map{}
+		if err := json.Unmarshal(body, &claims); err != nil {
+			return nil, errorsx.G11NError("unable to parse the UserInfo response; err=%v", err)
+		}
+
+		return &UserInfo{Map: claims}, nil
+	}
+
+	raw := strings.TrimSpace(string(body))
+	if strings.Count(raw, ".") == 4 {
+		if raw, err = c.decryptUserInfo(ctx, raw); err != nil {
+			return nil, err
+		}
+
+		// the decrypted payload is either the claims or a nested JWS
+		if strings.Count(raw, ".") != 2 {
+			if c.UserInfoSignedResponseAlg != "" {
+				return nil, errorsx.G11NError("the encrypted UserInfo response must contain a signed response")
+			}
+
+			claims := typesx.Map{}
+			if err := json.Unmarshal([]byte(raw), &claims); err != nil {
+				return nil, errorsx.G11NError("unable to parse the UserInfo response; err=%v", err)
+			}
+
+			return &UserInfo{Map: claims}, nil
+		}
+	} else if c.DecryptionKey != nil {
+		return nil, errorsx.G11NError("the UserInfo response must be encrypted")
+	}
+
+	claims, err := c.verifyUserInfo(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserInfo{Map: claims}, nil
+}
+
+func (c *Client) decryptUserInfo(ctx context.Context, raw string) (string, error) {
+	if c.DecryptionKey == nil {
+		return "", errorsx.G11NError("the UserInfo response is encrypted and 'DecryptionKey' is not set")
+	}
+
+	keyAlgs := defaultKeyEncryptionAlgorithms
+	encs := defaultContentEncryptionAlgorithms
+	if c.Discovery != nil {
+		config, err := c.Discovery.Configuration(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if len(config.UserinfoEncryptionAlgValuesSupported) > 0 {
+			keyAlgs = nil
+			for _, alg := range config.UserinfoEncryptionAlgValuesSupported {
+				keyAlgs = append(keyAlgs, jose.KeyAlgorithm(alg))
+			}
+		}
+
+		if len(config.UserinfoEncryptionEncValuesSupported) > 0 {
+			encs = nil
+			for _, enc := range config.UserinfoEncryptionEncValuesSupported {
+				encs = append(encs, jose.ContentEncryption(enc))
+			}
+		}
+	}
+
+	jwe, err := jose.ParseEncrypted(raw, keyAlgs, encs)
+	if err != nil {
+		return "", errorsx.G11NError("unable to parse the encrypted UserInfo response; err=%v", err)
+	}
+
+	plaintext, err := jwe.Decrypt(c.DecryptionKey)
+	if err != nil {
+		return "", errorsx.G11NError("unable to decrypt the UserInfo response; err=%v", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func (c *Client) verifyUserInfo(ctx context.Context, raw string) (typesx.Map, error) {
+	var supportedAlgs []string
+	issuer := ""
+	if c.Discovery != nil {
+		config, err := c.Discovery.Configuration(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		supportedAlgs = config.UserinfoSigningAlgValuesSupported
+		issuer = config.Issuer
+	}
+
+	if c.UserInfoSignedResponseAlg != "" {
+		supportedAlgs = []string{c.UserInfoSignedResponseAlg}
+	}
+
+	jwksURI := ""
+	if c.KeySet == nil {
+		var err error
+		if jwksURI, err = c.endpoint(ctx, jwksEndpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	keySet, err := remoteKeySet(c.KeySet, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := &jwt.Claims{}
+	claims := typesx.Map{}
+	if _, err := verifyJWT(ctx, keySet, raw, supportedAlgs, registered, &claims); err != nil {
+		return nil, err
+	}
+
+	if issuer != "" && registered.Issuer != "" && registered.Issuer != issuer {
+		return nil, errorsx.G11NError("the UserInfo response 'iss' does not match the issuer")
+	}
+
+	if len(registered.Audience) > 0 {
+		params, err := c.ClientAuth.GetParameters()
+		if err != nil {
+			return nil, err
+		}
+
+		if !registered.Audience.Contains(params.Get("client_id")) {
+			return nil, errorsx.G11NError("the UserInfo response 'aud' does not match the client")
+		}
+	}
+
+	return claims, nil
+}
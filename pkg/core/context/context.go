@@ -11,14 +11,32 @@ type ContextKey string
 const (
 	// VerifyCtxKey is the context key holding verify specific context
 	VerifyCtxKey ContextKey = "VCTX"
+
+	// AccessTokenClaimsCtxKey is the context key holding the claims of the access token
+	// validated by a resource server
+	AccessTokenClaimsCtxKey ContextKey = "VATCLAIMS"
+
+	// SessionCtxKey is the context key holding the authenticated session of a relying party
+	SessionCtxKey ContextKey = "VSESSION"
 )
 
+// DPoPProofGenerator generates DPoP proofs for requests made using DPoP-bound access tokens.
+type DPoPProofGenerator interface {
+	// Proof generates a DPoP proof for a request with the method to the URI that is bound
+	// to the access token.
+	Proof(method string, uri string, accessToken string) (string, error)
+}
+
 type VerifyContext struct {
 	Logger *logx.Logger
 
 	Tenant string
 
 	Token string
+
+	// DPoP optionally generates the DPoP proofs sent with requests when Token is a DPoP-bound
+	// access token. When set, the token is sent using the DPoP authorization scheme instead of Bearer.
+	DPoP DPoPProofGenerator
 }
 
 func NewContextWithVerifyContext(parentContext context.Context, logger *logx.Logger) (context.Context, error) {
@@ -0,0 +1,85 @@
+// Package qrx encodes short text, such as URLs, as QR codes and renders them for terminals.
+package qrx
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// ErrTooLong is returned when the text does not fit in the largest supported QR code.
+var ErrTooLong = errors.New("the text is too long to be encoded as a QR code")
+
+// quietZone is the number of light modules around the code. The QR code specification
+// requires a quiet zone of four modules; narrower margins fail to scan with some readers.
+const quietZone = 4
+
+// Code is an encoded QR code.
+type Code struct {
+	// Size is the number of modules on each side, excluding the quiet zone.
+	Size int
+
+	modules [][]bool
+}
+
+// Encode encodes the text using the smallest version that fits, at error correction level M,
+// which can restore about 15% of the code.
+func Encode(text string) (*Code, error) {
+	q, err := qrcode.New(text, qrcode.Medium)
+	if err != nil {
+		return nil, ErrTooLong
+	}
+
+	q.DisableBorder = true
+	modules := q.Bitmap()
+	return &Code{
+		Size:    len(modules),
+		modules: modules,
+	}, nil
+}
+
+// Dark reports whether the module at the column x and row y is dark.
+func (c *Code) Dark(x int, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+
+	return c.modules[y][x]
+}
+
+// Terminal renders the code using Unicode half blocks, so each line of text holds two rows of
+// modules. By default, light modules are drawn using the blocks, which suits terminals with a
+// dark background. Set inverted for terminals with a light background.
+func (c *Code) Terminal(inverted bool) string {
+	blocks := []string{" ", "▄", "▀", "█"}
+	sb := &strings.Builder{}
+	for y := -quietZone; y < c.Size+quietZone; y += 2 {
+		for x := -quietZone; x < c.Size+quietZone; x++ {
+			top, bottom := c.Dark(x, y), c.Dark(x, y+1)
+			if !inverted {
+				top, bottom = !top, !bottom
+			}
+
+			// the bottom quiet zone row is only half a line when the rows are odd
+			if y+1 >= c.Size+quietZone {
+				bottom = false
+			}
+
+			i := 0
+			if top {
+				i |= 2
+			}
+
+			if bottom {
+				i |= 1
+			}
+
+			sb.WriteString(blocks[i])
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,41 @@
+package qrx_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ibm-verify/verify-sdk-go/x/qrx"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type QRTestSuite struct {
+	suite.Suite
+}
+
+func (s *QRTestSuite) TestEncode() {
+	code, err := qrx.Encode("https://tenant.verify.ibm.com/oauth2/device?user_code=ABCD-EFGH")
+	require.NoError(s.T(), err, "unable to encode the URL")
+	require.Equal(s.T(), 1, code.Size%4, "the size should be 17 + 4 * version")
+	require.GreaterOrEqual(s.T(), code.Size, 21)
+
+	// the finder pattern in the top left corner, surrounded by the light separator
+	for i := 0; i < 7; i++ {
+		require.True(s.T(), code.Dark(i, 0), "the finder pattern should be dark at %d,0", i)
+		require.True(s.T(), code.Dark(0, i), "the finder pattern should be dark at 0,%d", i)
+		require.False(s.T(), code.Dark(i, 7), "the separator should be light at %d,7", i)
+	}
+	require.False(s.T(), code.Dark(-1, 0), "the quiet zone should be light")
+
+	lines := strings.Split(strings.TrimSuffix(code.Terminal(false), "\n"), "\n")
+	require.Len(s.T(), lines, (code.Size+8+1)/2, "each line should hold two rows of modules, including the quiet zone of 4 modules")
+}
+
+func (s *QRTestSuite) TestTooLong() {
+	_, err := qrx.Encode(strings.Repeat("x", 4000))
+	require.ErrorIs(s.T(), err, qrx.ErrTooLong)
+}
+
+func TestQRTestSuite(t *testing.T) {
+	suite.Run(t, new(QRTestSuite))
+}